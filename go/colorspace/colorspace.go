@@ -0,0 +1,644 @@
+// Package colorspace provides conversions between sRGB and a number of other
+// color spaces, including perceptually uniform spaces such as CIELAB and
+// OKLab. Each color space type implements color.Color, and each has a
+// corresponding color.Model, so that they interoperate with the standard
+// image and image/color packages.
+//
+// All of the types in this package represent opaque colors; alpha is discarded
+// when converting into them, as with color.YCbCr.
+package colorspace
+
+import (
+	"image/color"
+	"math"
+)
+
+// D65 reference white point, normalized so that Y = 1. This is derived from
+// the sRGB conversion matrix so that sRGB white maps exactly to neutral Lab.
+var whiteX, whiteY, whiteZ = rgbToXYZ.mul(1, 1, 1)
+
+// SRGB represents a gamma-encoded sRGB color, with each channel in [0, 1].
+type SRGB struct {
+	R, G, B float64
+}
+
+// LinearRGB represents a linear-light sRGB color, with each channel in
+// [0, 1].
+type LinearRGB struct {
+	R, G, B float64
+}
+
+// XYZ represents a CIE 1931 XYZ color, relative to the D65 white point with
+// Y = 1 for white.
+type XYZ struct {
+	X, Y, Z float64
+}
+
+// Lab represents a CIELAB color, relative to the D65 white point. L is in
+// [0, 100].
+type Lab struct {
+	L, A, B float64
+}
+
+// LCH represents a CIELAB color in cylindrical coordinates. H is in degrees,
+// in [0, 360).
+type LCH struct {
+	L, C, H float64
+}
+
+// LabD50 represents a CIELAB color relative to the D50 white point, as used by
+// ICC profiles and Adobe swatch files. L is in [0, 100].
+type LabD50 struct {
+	L, A, B float64
+}
+
+// OKLab represents a color in Björn Ottosson's OKLab space. L is in [0, 1].
+type OKLab struct {
+	L, A, B float64
+}
+
+// OKLCH represents an OKLab color in cylindrical coordinates. H is in degrees,
+// in [0, 360).
+type OKLCH struct {
+	L, C, H float64
+}
+
+// HSL represents a hue/saturation/lightness color. H is in degrees, in
+// [0, 360); S and L are in [0, 1].
+type HSL struct {
+	H, S, L float64
+}
+
+// HSV represents a hue/saturation/value color. H is in degrees, in [0, 360);
+// S and V are in [0, 1].
+type HSV struct {
+	H, S, V float64
+}
+
+// HSI represents a hue/saturation/intensity color. H is in degrees, in
+// [0, 360); S and I are in [0, 1].
+type HSI struct {
+	H, S, I float64
+}
+
+// Models for each of the color spaces in this package.
+var (
+	SRGBModel      color.Model = color.ModelFunc(srgbModel)
+	LinearRGBModel color.Model = color.ModelFunc(linearRGBModel)
+	XYZModel       color.Model = color.ModelFunc(xyzModel)
+	LabModel       color.Model = color.ModelFunc(labModel)
+	LCHModel       color.Model = color.ModelFunc(lchModel)
+	OKLabModel     color.Model = color.ModelFunc(oklabModel)
+	OKLCHModel     color.Model = color.ModelFunc(oklchModel)
+	HSLModel       color.Model = color.ModelFunc(hslModel)
+	HSVModel       color.Model = color.ModelFunc(hsvModel)
+	HSIModel       color.Model = color.ModelFunc(hsiModel)
+)
+
+func srgbModel(c color.Color) color.Color {
+	if _, ok := c.(SRGB); ok {
+		return c
+	}
+	return ToSRGB(c)
+}
+
+func linearRGBModel(c color.Color) color.Color {
+	if _, ok := c.(LinearRGB); ok {
+		return c
+	}
+	return ToSRGB(c).Linear()
+}
+
+func xyzModel(c color.Color) color.Color {
+	if _, ok := c.(XYZ); ok {
+		return c
+	}
+	return ToSRGB(c).Linear().XYZ()
+}
+
+func labModel(c color.Color) color.Color {
+	if _, ok := c.(Lab); ok {
+		return c
+	}
+	return ToLab(c)
+}
+
+func lchModel(c color.Color) color.Color {
+	if _, ok := c.(LCH); ok {
+		return c
+	}
+	return ToLab(c).LCH()
+}
+
+func oklabModel(c color.Color) color.Color {
+	if _, ok := c.(OKLab); ok {
+		return c
+	}
+	return ToOKLab(c)
+}
+
+func oklchModel(c color.Color) color.Color {
+	if _, ok := c.(OKLCH); ok {
+		return c
+	}
+	return ToOKLab(c).LCH()
+}
+
+func hslModel(c color.Color) color.Color {
+	if _, ok := c.(HSL); ok {
+		return c
+	}
+	return ToSRGB(c).HSL()
+}
+
+func hsvModel(c color.Color) color.Color {
+	if _, ok := c.(HSV); ok {
+		return c
+	}
+	return ToSRGB(c).HSV()
+}
+
+func hsiModel(c color.Color) color.Color {
+	if _, ok := c.(HSI); ok {
+		return c
+	}
+	return ToSRGB(c).HSI()
+}
+
+// ToSRGB converts the given color.Color to SRGB. Premultiplied alpha is
+// removed before conversion, and the alpha value itself is discarded.
+func ToSRGB(c color.Color) SRGB {
+	if s, ok := c.(SRGB); ok {
+		return s
+	}
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return SRGB{}
+	}
+	return SRGB{
+		R: float64(r) / float64(a),
+		G: float64(g) / float64(a),
+		B: float64(b) / float64(a),
+	}
+}
+
+// ToLab converts the given color.Color to Lab.
+func ToLab(c color.Color) Lab {
+	if l, ok := c.(Lab); ok {
+		return l
+	}
+	return ToSRGB(c).Linear().XYZ().Lab()
+}
+
+// ToOKLab converts the given color.Color to OKLab.
+func ToOKLab(c color.Color) OKLab {
+	if l, ok := c.(OKLab); ok {
+		return l
+	}
+	return ToSRGB(c).Linear().OKLab()
+}
+
+// rgba converts floating point channels in [0, 1] to 16-bit values, as
+// returned by color.Color.RGBA. Out-of-gamut values are clamped.
+func rgba(r, g, b float64) (uint32, uint32, uint32, uint32) {
+	return to16(r), to16(g), to16(b), 0xffff
+}
+
+func to16(v float64) uint32 {
+	v = math.Round(v * 0xffff)
+	if v < 0 {
+		return 0
+	} else if v > 0xffff {
+		return 0xffff
+	}
+	return uint32(v)
+}
+
+// RGBA implements color.Color.
+func (c SRGB) RGBA() (uint32, uint32, uint32, uint32) {
+	return rgba(c.R, c.G, c.B)
+}
+
+// Linear converts the color to linear RGB.
+func (c SRGB) Linear() LinearRGB {
+	return LinearRGB{
+		R: Linearize(c.R),
+		G: Linearize(c.G),
+		B: Linearize(c.B),
+	}
+}
+
+// Linearize applies the inverse sRGB transfer function to a single gamma-
+// encoded channel value.
+func Linearize(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// Delinearize applies the sRGB transfer function to a single linear channel
+// value.
+func Delinearize(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// RGBA implements color.Color.
+func (c LinearRGB) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.SRGB().RGBA()
+}
+
+// SRGB converts the color to gamma-encoded sRGB.
+func (c LinearRGB) SRGB() SRGB {
+	return SRGB{
+		R: Delinearize(c.R),
+		G: Delinearize(c.G),
+		B: Delinearize(c.B),
+	}
+}
+
+// rgbToXYZ is the linear sRGB to XYZ conversion matrix. xyzToRGB is computed
+// from it, rather than using the rounded published inverse, so that round
+// trips are exact to within floating point error.
+var (
+	rgbToXYZ = matrix3{
+		{0.4124564, 0.3575761, 0.1804375},
+		{0.2126729, 0.7151522, 0.0721750},
+		{0.0193339, 0.1191920, 0.9503041},
+	}
+	xyzToRGB = rgbToXYZ.inverse()
+)
+
+// D50 reference white point, normalized so that Y = 1, and the Bradford
+// chromatic adaptation from it to the D65 white point used by XYZ.
+var (
+	whiteD50X, whiteD50Y, whiteD50Z = 0.96422, 1.0, 0.82521
+
+	bradford = matrix3{
+		{0.8951, 0.2664, -0.1614},
+		{-0.7502, 1.7135, 0.0367},
+		{0.0389, -0.0685, 1.0296},
+	}
+	d50ToD65 = adaptation(bradford, [3]float64{whiteD50X, whiteD50Y, whiteD50Z}, [3]float64{whiteX, whiteY, whiteZ})
+)
+
+// adaptation returns the matrix which adapts XYZ colors from the src white
+// point to the dst white point, by scaling the responses of the given cone
+// response matrix.
+func adaptation(cone matrix3, src, dst [3]float64) matrix3 {
+	srcL, srcM, srcS := cone.mul(src[0], src[1], src[2])
+	dstL, dstM, dstS := cone.mul(dst[0], dst[1], dst[2])
+	scale := matrix3{
+		{dstL / srcL, 0, 0},
+		{0, dstM / srcM, 0},
+		{0, 0, dstS / srcS},
+	}
+	return cone.inverse().mulMatrix(scale.mulMatrix(cone))
+}
+
+// matrix3 is a 3x3 matrix.
+type matrix3 [3][3]float64
+
+// mul multiplies the matrix by the given column vector.
+func (m matrix3) mul(a, b, c float64) (float64, float64, float64) {
+	return m[0][0]*a + m[0][1]*b + m[0][2]*c,
+		m[1][0]*a + m[1][1]*b + m[1][2]*c,
+		m[2][0]*a + m[2][1]*b + m[2][2]*c
+}
+
+// mulMatrix returns the product of the matrix and the other matrix.
+func (m matrix3) mulMatrix(other matrix3) matrix3 {
+	var rv matrix3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				rv[i][j] += m[i][k] * other[k][j]
+			}
+		}
+	}
+	return rv
+}
+
+// inverse returns the inverse of the matrix, which must be non-singular.
+func (m matrix3) inverse() matrix3 {
+	var rv matrix3
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// Cofactor of element (j, i), ie. the adjugate.
+			r0, r1 := (j+1)%3, (j+2)%3
+			c0, c1 := (i+1)%3, (i+2)%3
+			rv[i][j] = (m[r0][c0]*m[r1][c1] - m[r0][c1]*m[r1][c0]) / det
+		}
+	}
+	return rv
+}
+
+// XYZ converts the color to CIE XYZ.
+func (c LinearRGB) XYZ() XYZ {
+	x, y, z := rgbToXYZ.mul(c.R, c.G, c.B)
+	return XYZ{X: x, Y: y, Z: z}
+}
+
+// OKLab converts the color to OKLab.
+func (c LinearRGB) OKLab() OKLab {
+	l := math.Cbrt(0.4122214708*c.R + 0.5363325363*c.G + 0.0514459929*c.B)
+	m := math.Cbrt(0.2119034982*c.R + 0.6806995451*c.G + 0.1073969566*c.B)
+	s := math.Cbrt(0.0883024619*c.R + 0.2817188376*c.G + 0.6299787005*c.B)
+	return OKLab{
+		L: 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		A: 1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		B: 0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// RGBA implements color.Color.
+func (c XYZ) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.LinearRGB().RGBA()
+}
+
+// LinearRGB converts the color to linear RGB.
+func (c XYZ) LinearRGB() LinearRGB {
+	r, g, b := xyzToRGB.mul(c.X, c.Y, c.Z)
+	return LinearRGB{R: r, G: g, B: b}
+}
+
+// CIELAB constants.
+const (
+	labEpsilon = 216.0 / 24389.0
+	labKappa   = 24389.0 / 27.0
+)
+
+func labF(t float64) float64 {
+	if t > labEpsilon {
+		return math.Cbrt(t)
+	}
+	return (labKappa*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > labEpsilon {
+		return t3
+	}
+	return (116*t - 16) / labKappa
+}
+
+// Lab converts the color to CIELAB.
+func (c XYZ) Lab() Lab {
+	fx := labF(c.X / whiteX)
+	fy := labF(c.Y / whiteY)
+	fz := labF(c.Z / whiteZ)
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+// RGBA implements color.Color.
+func (c Lab) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.XYZ().RGBA()
+}
+
+// XYZ converts the color to CIE XYZ.
+func (c Lab) XYZ() XYZ {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+	return XYZ{
+		X: whiteX * labFInv(fx),
+		Y: whiteY * labFInv(fy),
+		Z: whiteZ * labFInv(fz),
+	}
+}
+
+// LCH converts the color to cylindrical coordinates.
+func (c Lab) LCH() LCH {
+	return LCH{
+		L: c.L,
+		C: math.Hypot(c.A, c.B),
+		H: hueDegrees(c.A, c.B),
+	}
+}
+
+// RGBA implements color.Color.
+func (c LCH) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.Lab().RGBA()
+}
+
+// Lab converts the color to rectangular coordinates.
+func (c LCH) Lab() Lab {
+	rad := c.H * math.Pi / 180
+	return Lab{
+		L: c.L,
+		A: c.C * math.Cos(rad),
+		B: c.C * math.Sin(rad),
+	}
+}
+
+// RGBA implements color.Color.
+func (c LabD50) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.XYZ().RGBA()
+}
+
+// XYZ converts the color to CIE XYZ, relative to the D65 white point.
+func (c LabD50) XYZ() XYZ {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+	x, y, z := d50ToD65.mul(whiteD50X*labFInv(fx), whiteD50Y*labFInv(fy), whiteD50Z*labFInv(fz))
+	return XYZ{X: x, Y: y, Z: z}
+}
+
+// RGBA implements color.Color.
+func (c OKLab) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.LinearRGB().RGBA()
+}
+
+// LinearRGB converts the color to linear RGB.
+func (c OKLab) LinearRGB() LinearRGB {
+	l := c.L + 0.3963377774*c.A + 0.2158037573*c.B
+	m := c.L - 0.1055613458*c.A - 0.0638541728*c.B
+	s := c.L - 0.0894841775*c.A - 1.2914855480*c.B
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return LinearRGB{
+		R: 4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		G: -1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		B: -0.0041960863*l - 0.7034186147*m + 1.7076147010*s,
+	}
+}
+
+// LCH converts the color to cylindrical coordinates.
+func (c OKLab) LCH() OKLCH {
+	return OKLCH{
+		L: c.L,
+		C: math.Hypot(c.A, c.B),
+		H: hueDegrees(c.A, c.B),
+	}
+}
+
+// RGBA implements color.Color.
+func (c OKLCH) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.OKLab().RGBA()
+}
+
+// OKLab converts the color to rectangular coordinates.
+func (c OKLCH) OKLab() OKLab {
+	rad := c.H * math.Pi / 180
+	return OKLab{
+		L: c.L,
+		A: c.C * math.Cos(rad),
+		B: c.C * math.Sin(rad),
+	}
+}
+
+// hueDegrees returns the angle of the given vector in degrees, in [0, 360).
+func hueDegrees(a, b float64) float64 {
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// hueChroma returns the hue, in degrees, and the chroma of the given sRGB
+// channels, as used by the HSL and HSV models.
+func hueChroma(r, g, b float64) (hue, chroma, max, min float64) {
+	max = math.Max(r, math.Max(g, b))
+	min = math.Min(r, math.Min(g, b))
+	chroma = max - min
+	if chroma == 0 {
+		return 0, 0, max, min
+	}
+	switch max {
+	case r:
+		hue = math.Mod((g-b)/chroma, 6)
+	case g:
+		hue = (b-r)/chroma + 2
+	default:
+		hue = (r-g)/chroma + 4
+	}
+	hue *= 60
+	if hue < 0 {
+		hue += 360
+	}
+	return hue, chroma, max, min
+}
+
+// fromHueChroma returns the sRGB channels for the given hue, chroma and
+// lightness offset, as used by the HSL and HSV models.
+func fromHueChroma(hue, chroma, m float64) SRGB {
+	h := math.Mod(hue, 360)
+	if h < 0 {
+		h += 360
+	}
+	h /= 60
+	x := chroma * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 1:
+		r, g, b = chroma, x, 0
+	case h < 2:
+		r, g, b = x, chroma, 0
+	case h < 3:
+		r, g, b = 0, chroma, x
+	case h < 4:
+		r, g, b = 0, x, chroma
+	case h < 5:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return SRGB{R: r + m, G: g + m, B: b + m}
+}
+
+// HSL converts the color to HSL.
+func (c SRGB) HSL() HSL {
+	hue, chroma, max, min := hueChroma(c.R, c.G, c.B)
+	l := (max + min) / 2
+	s := 0.0
+	if l > 0 && l < 1 {
+		s = chroma / (1 - math.Abs(2*l-1))
+	}
+	return HSL{H: hue, S: s, L: l}
+}
+
+// HSV converts the color to HSV.
+func (c SRGB) HSV() HSV {
+	hue, chroma, max, _ := hueChroma(c.R, c.G, c.B)
+	s := 0.0
+	if max > 0 {
+		s = chroma / max
+	}
+	return HSV{H: hue, S: s, V: max}
+}
+
+// HSI converts the color to HSI.
+func (c SRGB) HSI() HSI {
+	i := (c.R + c.G + c.B) / 3
+	if i == 0 {
+		return HSI{}
+	}
+	min := math.Min(c.R, math.Min(c.G, c.B))
+	s := 1 - min/i
+	if s == 0 {
+		return HSI{I: i}
+	}
+	// Hue is the angle of the color projected onto the chromaticity plane.
+	h := hueDegrees(c.R-(c.G+c.B)/2, math.Sqrt(3)/2*(c.G-c.B))
+	return HSI{H: h, S: s, I: i}
+}
+
+// RGBA implements color.Color.
+func (c HSL) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.SRGB().RGBA()
+}
+
+// SRGB converts the color to sRGB.
+func (c HSL) SRGB() SRGB {
+	chroma := (1 - math.Abs(2*c.L-1)) * c.S
+	return fromHueChroma(c.H, chroma, c.L-chroma/2)
+}
+
+// RGBA implements color.Color.
+func (c HSV) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.SRGB().RGBA()
+}
+
+// SRGB converts the color to sRGB.
+func (c HSV) SRGB() SRGB {
+	chroma := c.V * c.S
+	return fromHueChroma(c.H, chroma, c.V-chroma)
+}
+
+// RGBA implements color.Color.
+func (c HSI) RGBA() (uint32, uint32, uint32, uint32) {
+	return c.SRGB().RGBA()
+}
+
+// SRGB converts the color to sRGB.
+func (c HSI) SRGB() SRGB {
+	h := math.Mod(c.H, 360)
+	if h < 0 {
+		h += 360
+	}
+	// Rotate into the first sector, compute, then rotate the channels back.
+	sector := int(h / 120)
+	h = (h - float64(sector)*120) * math.Pi / 180
+	x := c.I * (1 - c.S)
+	y := c.I * (1 + c.S*math.Cos(h)/math.Cos(math.Pi/3-h))
+	z := 3*c.I - (x + y)
+	switch sector {
+	case 0:
+		return SRGB{R: y, G: z, B: x}
+	case 1:
+		return SRGB{R: x, G: y, B: z}
+	default:
+		return SRGB{R: z, G: x, B: y}
+	}
+}
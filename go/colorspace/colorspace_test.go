@@ -0,0 +1,105 @@
+package colorspace
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testColors returns a grid of opaque colors covering the RGB cube.
+func testColors() []color.Color {
+	var rv []color.Color
+	for r := 0; r <= 0xffff; r += 0x1111 {
+		for g := 0; g <= 0xffff; g += 0x1111 {
+			for b := 0; b <= 0xffff; b += 0x1111 {
+				rv = append(rv, color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: 0xffff})
+			}
+		}
+	}
+	// Include some values which don't land on 8-bit boundaries.
+	rv = append(rv,
+		color.RGBA64{R: 1, G: 2, B: 3, A: 0xffff},
+		color.RGBA64{R: 0x1234, G: 0xabcd, B: 0xfffe, A: 0xffff},
+		color.RGBA64{R: 0x7fff, G: 0x8000, B: 0x8001, A: 0xffff},
+	)
+	return rv
+}
+
+func TestRoundTrip(t *testing.T) {
+	test := func(name string, convert func(color.Color) color.Color) {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range testColors() {
+				expect := color.RGBA64Model.Convert(c)
+				actual := color.RGBA64Model.Convert(convert(c))
+				require.Equal(t, expect, actual, "%T %+v", convert(c), convert(c))
+			}
+		})
+	}
+	test("SRGB", SRGBModel.Convert)
+	test("LinearRGB", LinearRGBModel.Convert)
+	test("XYZ", XYZModel.Convert)
+	test("Lab", LabModel.Convert)
+	test("LCH", LCHModel.Convert)
+	test("OKLab", OKLabModel.Convert)
+	test("OKLCH", OKLCHModel.Convert)
+	test("HSL", HSLModel.Convert)
+	test("HSV", HSVModel.Convert)
+	test("HSI", HSIModel.Convert)
+	test("Lab via OKLab", func(c color.Color) color.Color {
+		return LabModel.Convert(OKLabModel.Convert(c))
+	})
+}
+
+func TestKnownValues(t *testing.T) {
+	const delta = 1e-4
+	check := func(expect, actual [3]float64) {
+		for i := range expect {
+			require.InDelta(t, expect[i], actual[i], delta, "expected %v but got %v", expect, actual)
+		}
+	}
+
+	white := ToLab(color.White)
+	check([3]float64{100, 0, 0}, [3]float64{white.L, white.A, white.B})
+	black := ToLab(color.Black)
+	check([3]float64{0, 0, 0}, [3]float64{black.L, black.A, black.B})
+	red := ToLab(color.RGBA{R: 255, A: 255})
+	require.InDelta(t, 53.24, red.L, 0.01)
+	require.InDelta(t, 80.09, red.A, 0.01)
+	require.InDelta(t, 67.20, red.B, 0.01)
+	redLCH := red.LCH()
+	check([3]float64{red.L, 104.5518, 39.9990}, [3]float64{redLCH.L, redLCH.C, redLCH.H})
+
+	// Adobe swatch files give sRGB red relative to D50.
+	d50White := color.NRGBAModel.Convert(LabD50{L: 100}).(color.NRGBA)
+	require.Equal(t, color.NRGBA{R: 255, G: 255, B: 255, A: 255}, d50White)
+	d50Red := color.NRGBAModel.Convert(LabD50{L: 54.29, A: 80.81, B: 69.89}).(color.NRGBA)
+	require.InDelta(t, 255, d50Red.R, 1)
+	require.InDelta(t, 0, d50Red.G, 1)
+	require.InDelta(t, 0, d50Red.B, 1)
+
+	okWhite := ToOKLab(color.White)
+	check([3]float64{1, 0, 0}, [3]float64{okWhite.L, okWhite.A, okWhite.B})
+	okRed := ToOKLab(color.RGBA{R: 255, A: 255})
+	check([3]float64{0.62796, 0.22486, 0.12585}, [3]float64{okRed.L, okRed.A, okRed.B})
+
+	hsl := ToSRGB(color.RGBA{R: 255, G: 128, A: 255}).HSL()
+	check([3]float64{30.1176, 1, 0.5}, [3]float64{hsl.H, hsl.S, hsl.L})
+	hsv := ToSRGB(color.RGBA{R: 0, G: 0, B: 128, A: 255}).HSV()
+	check([3]float64{240, 1, 128.0 / 255}, [3]float64{hsv.H, hsv.S, hsv.V})
+	hsi := ToSRGB(color.RGBA{G: 255, A: 255}).HSI()
+	check([3]float64{120, 1, 1.0 / 3}, [3]float64{hsi.H, hsi.S, hsi.I})
+}
+
+func TestPremultipliedAlpha(t *testing.T) {
+	// A half-transparent color should convert the same as its opaque
+	// equivalent.
+	require.Equal(t,
+		ToSRGB(color.NRGBA{R: 200, G: 100, B: 50, A: 255}),
+		ToSRGB(color.NRGBA64{R: 200 * 0x101, G: 100 * 0x101, B: 50 * 0x101, A: 0xffff}),
+	)
+	c := ToSRGB(color.NRGBA{R: 200, G: 100, B: 50, A: 128})
+	require.InDelta(t, 200.0/255, c.R, 0.005)
+	require.InDelta(t, 100.0/255, c.G, 0.005)
+	require.InDelta(t, 50.0/255, c.B, 0.005)
+}
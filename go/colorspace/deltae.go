@@ -0,0 +1,130 @@
+package colorspace
+
+import "math"
+
+// DeltaE76 returns the CIE76 color difference between two Lab colors, which
+// is simply their Euclidean distance.
+func DeltaE76(a, b Lab) float64 {
+	dl := a.L - b.L
+	da := a.A - b.A
+	db := a.B - b.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// DeltaE94 returns the CIE94 color difference between two Lab colors, using
+// the graphic arts weighting constants. Note that CIE94 is not symmetric; a is
+// the reference color.
+func DeltaE94(a, b Lab) float64 {
+	const (
+		kL = 1.0
+		k1 = 0.045
+		k2 = 0.015
+	)
+	c1 := math.Hypot(a.A, a.B)
+	c2 := math.Hypot(b.A, b.B)
+	dl := a.L - b.L
+	dc := c1 - c2
+	da := a.A - b.A
+	db := a.B - b.B
+	// Computing ΔH directly from the hue angles is numerically unstable, so
+	// derive it from the other differences instead.
+	dh2 := da*da + db*db - dc*dc
+	if dh2 < 0 {
+		dh2 = 0
+	}
+	sl := 1.0
+	sc := 1 + k1*c1
+	sh := 1 + k2*c1
+	tl := dl / (kL * sl)
+	tc := dc / sc
+	return math.Sqrt(tl*tl + tc*tc + dh2/(sh*sh))
+}
+
+// DeltaE2000 returns the CIEDE2000 color difference between two Lab colors.
+// This follows the formulation in Sharma, Wu and Dalal, "The CIEDE2000
+// Color-Difference Formula: Implementation Notes, Supplementary Test Data,
+// and Mathematical Observations" (2005).
+func DeltaE2000(a, b Lab) float64 {
+	const (
+		kL = 1.0
+		kC = 1.0
+		kH = 1.0
+	)
+	pow25to7 := math.Pow(25, 7)
+
+	c1 := math.Hypot(a.A, a.B)
+	c2 := math.Hypot(b.A, b.B)
+	cBar := (c1 + c2) / 2
+	cBar7 := math.Pow(cBar, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+pow25to7)))
+	a1 := (1 + g) * a.A
+	a2 := (1 + g) * b.A
+	c1p := math.Hypot(a1, a.B)
+	c2p := math.Hypot(a2, b.B)
+	h1p := 0.0
+	if c1p != 0 {
+		h1p = hueDegrees(a1, a.B)
+	}
+	h2p := 0.0
+	if c2p != 0 {
+		h2p = hueDegrees(a2, b.B)
+	}
+
+	dLp := b.L - a.L
+	dCp := c2p - c1p
+	dhp := 0.0
+	if c1p*c2p != 0 {
+		dhp = h2p - h1p
+		if dhp > 180 {
+			dhp -= 360
+		} else if dhp < -180 {
+			dhp += 360
+		}
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(radians(dhp/2))
+
+	lBarP := (a.L + b.L) / 2
+	cBarP := (c1p + c2p) / 2
+	hBarP := h1p + h2p
+	if c1p*c2p != 0 {
+		if math.Abs(h1p-h2p) <= 180 {
+			hBarP /= 2
+		} else if h1p+h2p < 360 {
+			hBarP = (hBarP + 360) / 2
+		} else {
+			hBarP = (hBarP - 360) / 2
+		}
+	}
+
+	t := 1 -
+		0.17*math.Cos(radians(hBarP-30)) +
+		0.24*math.Cos(radians(2*hBarP)) +
+		0.32*math.Cos(radians(3*hBarP+6)) -
+		0.20*math.Cos(radians(4*hBarP-63))
+	dTheta := 30 * math.Exp(-math.Pow((hBarP-275)/25, 2))
+	cBarP7 := math.Pow(cBarP, 7)
+	rc := 2 * math.Sqrt(cBarP7/(cBarP7+pow25to7))
+	lBarP50 := (lBarP - 50) * (lBarP - 50)
+	sl := 1 + 0.015*lBarP50/math.Sqrt(20+lBarP50)
+	sc := 1 + 0.045*cBarP
+	sh := 1 + 0.015*cBarP*t
+	rt := -math.Sin(radians(2*dTheta)) * rc
+
+	tl := dLp / (kL * sl)
+	tc := dCp / (kC * sc)
+	th := dHp / (kH * sh)
+	return math.Sqrt(tl*tl + tc*tc + th*th + rt*tc*th)
+}
+
+// DeltaEOK returns the color difference between two OKLab colors, which is
+// their Euclidean distance.
+func DeltaEOK(a, b OKLab) float64 {
+	dl := a.L - b.L
+	da := a.A - b.A
+	db := a.B - b.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
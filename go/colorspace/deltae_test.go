@@ -0,0 +1,42 @@
+package colorspace
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaE2000(t *testing.T) {
+	// Test data from Sharma, Wu and Dalal (2005).
+	check := func(a, b Lab, expect float64) {
+		require.InDelta(t, expect, DeltaE2000(a, b), 1e-4, "%+v vs %+v", a, b)
+		require.InDelta(t, expect, DeltaE2000(b, a), 1e-4, "%+v vs %+v", b, a)
+	}
+	check(Lab{50, 2.6772, -79.7751}, Lab{50, 0, -82.7485}, 2.0425)
+	check(Lab{50, 3.1571, -77.2803}, Lab{50, 0, -82.7485}, 2.8615)
+	check(Lab{50, 0, 0}, Lab{50, -1, 2}, 2.3669)
+	check(Lab{50, -1, 2}, Lab{50, 0, 0}, 2.3669)
+	check(Lab{50, 2.49, -0.001}, Lab{50, -2.49, 0.0011}, 7.2195)
+	check(Lab{50, 2.5, 0}, Lab{73, 25, -18}, 27.1492)
+	check(Lab{50, 2.5, 0}, Lab{50, 3.2592, 0.335}, 1)
+	check(Lab{60.2574, -34.0099, 36.2677}, Lab{60.4626, -34.1751, 39.4387}, 1.2644)
+	check(Lab{22.7233, 20.0904, -46.694}, Lab{23.0331, 14.973, -42.5619}, 2.0373)
+	check(Lab{90.8027, -2.0831, 1.441}, Lab{91.1528, -1.6435, 0.0447}, 1.4441)
+	check(Lab{2.0776, 0.0795, -1.135}, Lab{0.9033, -0.0636, -0.5514}, 0.9082)
+}
+
+func TestDeltaE94(t *testing.T) {
+	require.InDelta(t, 1.3950, DeltaE94(Lab{50, 2.6772, -79.7751}, Lab{50, 0, -82.7485}), 1e-4)
+	require.Equal(t, 0.0, DeltaE94(Lab{50, 10, 10}, Lab{50, 10, 10}))
+	// Pure lightness differences are not weighted.
+	require.InDelta(t, 10, DeltaE94(Lab{50, 10, 10}, Lab{60, 10, 10}), 1e-9)
+}
+
+func TestDeltaE76(t *testing.T) {
+	require.InDelta(t, 5, DeltaE76(Lab{50, 0, 0}, Lab{50, 3, 4}), 1e-9)
+}
+
+func TestDeltaEOK(t *testing.T) {
+	require.InDelta(t, 1, DeltaEOK(ToOKLab(color.Black), ToOKLab(color.White)), 1e-6)
+}
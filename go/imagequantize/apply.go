@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+)
+
+// runApply quantizes an image to an existing palette.
+func runApply(args []string) error {
+	fs := newFlagSet("apply", "--input <image> --palette <palette> --output <image> [flags]", "Quantize an image to an existing palette, without creating a new one. PNG and GIF outputs are indexed images whose palette holds the given colors in order.")
+	input := fs.String("input", "", "Image file to quantize, or \"-\" to read from stdin.")
+	paletteFile := fs.String("palette", "", "Palette file whose colors are applied to the image, in any supported format including swatch images.")
+	output := fs.String("output", "", "Image file to write, or \"-\" to write to stdout.")
+	format := fs.String("format", "png", fmt.Sprintf("Format of the image written, unless given by the extension of --output. One of: %s", strings.Join(imageFormatNames, ", ")))
+	ditherFlags := addDitherFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *input == "" || *paletteFile == "" || *output == "" {
+		return usageError(fs, "--input, --palette and --output are required")
+	}
+	if _, ok := imageFormats[*format]; !ok {
+		return usageError(fs, "unknown --format %q; expected one of: %s", *format, strings.Join(imageFormatNames, ", "))
+	}
+	ditherer, err := ditherFlags.parse()
+	if err != nil {
+		return err
+	}
+	p, err := readPalette(*paletteFile)
+	if err != nil {
+		return err
+	}
+	if err := palette.CheckPalette(p.Colors); err != nil {
+		return fmt.Errorf("%s: %w", *paletteFile, err)
+	}
+	img, err := readImage(*input)
+	if err != nil {
+		return err
+	}
+	return writeImageFile(*output, *format, ditherer.Dither(img, p.Colors))
+}
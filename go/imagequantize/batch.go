@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchImageExtensions are the extensions of the files processed when a
+// directory is given to --batch.
+var batchImageExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+// sharedSampleSize is the largest width and height to which each image is
+// downsampled when building a palette shared by all images in a batch.
+const sharedSampleSize = 128
+
+// batchInput is an image found by expanding --batch.
+type batchInput struct {
+	// path is the path to the image.
+	path string
+	// outDir is the directory of the mirrored output tree in which its
+	// results are written.
+	outDir string
+}
+
+// globRoot returns the longest leading directory of the pattern which does not
+// contain any glob metacharacters.
+func globRoot(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for strings.ContainsAny(dir, "*?[\\") && dir != filepath.Dir(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// findBatchInputs expands the given directories, which are searched
+// recursively for images, and glob patterns into a sorted list of images.
+// Each image's output directory mirrors its position relative to the
+// directory or pattern which found it, rooted at outputRoot. Files within
+// outputRoot are skipped, so that results are never processed as inputs.
+func findBatchInputs(patterns []string, outputRoot string) ([]batchInput, error) {
+	absOutputRoot, err := filepath.Abs(outputRoot)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]batchInput{}
+	add := func(root, path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if abs == absOutputRoot || strings.HasPrefix(abs, absOutputRoot+string(filepath.Separator)) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		found[path] = batchInput{path: path, outDir: filepath.Join(outputRoot, rel)}
+		return nil
+	}
+	for _, pattern := range patterns {
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			err := filepath.WalkDir(pattern, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() || !contains(batchImageExtensions, strings.ToLower(filepath.Ext(path))) {
+					return nil
+				}
+				return add(pattern, path)
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, invalidUsage(fmt.Errorf("invalid --batch pattern %q: %s", pattern, err))
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("--batch pattern %q matches no files", pattern)
+		}
+		root := globRoot(pattern)
+		for _, path := range matches {
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+			if err := add(root, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	rv := make([]batchInput, 0, len(found))
+	for _, input := range found {
+		rv = append(rv, input)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].path < rv[j].path
+	})
+	return rv, nil
+}
+
+// runPool calls fn for each index in [0, n) using at most the given number of
+// concurrent workers, and returns the error for each index. Panics are
+// returned as errors.
+func runPool(n, workers int, fn func(idx int) error) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				errs[idx] = recoverError(func() error {
+					return fn(idx)
+				})
+			}
+		}()
+	}
+	for idx := 0; idx < n; idx++ {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
+
+// sampleImage returns a copy of the image downsampled, by nearest neighbor, to
+// fit within sharedSampleSize pixels square.
+func sampleImage(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > sharedSampleSize {
+		height = height * sharedSampleSize / width
+		width = sharedSampleSize
+	}
+	if height > sharedSampleSize {
+		width = width * sharedSampleSize / height
+		height = sharedSampleSize
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	rv := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			rv.Set(x, y, img.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+	return rv
+}
+
+// sharedPalette runs the quantizer's algorithm over a sample of every image
+// which can be read, so that all images may be quantized with one palette.
+// Images which cannot be read are reported in the returned errors.
+func (q *quantizer) sharedPalette(inputs []batchInput, workers int) (color.Palette, []error, error) {
+	samples := make([]*image.NRGBA, len(inputs))
+	errs := runPool(len(inputs), workers, func(idx int) error {
+		img, err := readImage(inputs[idx].path)
+		if err != nil {
+			return err
+		}
+		samples[idx] = sampleImage(img)
+		return nil
+	})
+
+	// Stack the samples vertically into a single image.
+	width, height := 0, 0
+	for _, sample := range samples {
+		if sample != nil {
+			if sample.Bounds().Dx() > width {
+				width = sample.Bounds().Dx()
+			}
+			height += sample.Bounds().Dy()
+		}
+	}
+	if height == 0 {
+		return nil, errs, fmt.Errorf("no images could be read to build a shared palette")
+	}
+	combined := image.NewNRGBA(image.Rect(0, 0, width, height))
+	y := 0
+	for _, sample := range samples {
+		if sample == nil {
+			continue
+		}
+		// Pad narrow samples by repeating their last column, rather than
+		// adding transparent pixels to the palette.
+		for sy := 0; sy < sample.Bounds().Dy(); sy++ {
+			for x := 0; x < width; x++ {
+				sx := x
+				if sx >= sample.Bounds().Dx() {
+					sx = sample.Bounds().Dx() - 1
+				}
+				combined.SetNRGBA(x, y+sy, sample.NRGBAAt(sx, sy))
+			}
+		}
+		y += sample.Bounds().Dy()
+	}
+	p, err := q.alg.Run(combined, q.algParams)
+	return p, errs, err
+}
+
+// disambiguateOutputs keeps the extension in the {name} of inputs whose names
+// would otherwise clash, eg. a.png and a.jpg in the same directory, and then
+// returns a usage error if any two inputs would still write the same file.
+func disambiguateOutputs(inputs []batchInput, outs []*outputs) error {
+	byName := map[string][]int{}
+	for idx, out := range outs {
+		key := filepath.Join(out.dir, out.name)
+		byName[key] = append(byName[key], idx)
+	}
+	for _, idxs := range byName {
+		if len(idxs) > 1 {
+			for _, idx := range idxs {
+				outs[idx].name = filepath.Base(inputs[idx].path)
+			}
+		}
+	}
+	written := map[string]int{}
+	for idx, out := range outs {
+		for _, stage := range stageNames {
+			path, ok := out.path(stage)
+			if !ok {
+				continue
+			}
+			if prev, ok := written[path]; ok && prev != idx {
+				return invalidUsage(fmt.Errorf("--batch inputs %q and %q would both write %q; include {name} in --output", inputs[prev].path, inputs[idx].path, path))
+			}
+			written[path] = idx
+		}
+	}
+	return nil
+}
+
+// batchOptions holds the settings for runBatch.
+type batchOptions struct {
+	patterns   []string
+	outputRoot string
+	workers    int
+	shared     bool
+	force      bool
+	// keepPalette causes the shared palette to be built even if every image
+	// is up to date, because the caller uses it.
+	keepPalette bool
+	// template, format and stages are passed to newOutputs for each image.
+	template, format, stages string
+}
+
+// runBatch quantizes every image found by expanding the patterns, writing the
+// results into a tree under the output root which mirrors the inputs. Images
+// whose outputs are newer than they are are skipped unless force is set; with a
+// shared palette, outputs must be newer than every input, and the palette is
+// only built if some image is processed or the caller keeps it.
+// Failures are reported for each image without stopping the others. It returns
+// the palette shared by all images, if any, and the error for each failure.
+func (q *quantizer) runBatch(opts batchOptions) (color.Palette, []error, error) {
+	inputs, err := findBatchInputs(opts.patterns, opts.outputRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, nil, fmt.Errorf("--batch found no images")
+	}
+	outs := make([]*outputs, len(inputs))
+	for idx, input := range inputs {
+		template := opts.template
+		if template == "" {
+			template = inputOutputTemplate
+		}
+		outs[idx], err = newOutputs(input.path, input.outDir, template, opts.format, opts.stages)
+		if err != nil {
+			return nil, nil, err
+		}
+		if outs[idx].template == "-" {
+			return nil, nil, invalidUsage(fmt.Errorf("--batch cannot write to stdout"))
+		}
+	}
+	if err := disambiguateOutputs(inputs, outs); err != nil {
+		return nil, nil, err
+	}
+
+	// Each image depends on its own input, or, with a shared palette, on every
+	// input, since any of them may change the palette.
+	modTimes := make([]time.Time, len(inputs))
+	statErrs := make([]error, len(inputs))
+	var newest time.Time
+	for idx, input := range inputs {
+		info, err := os.Stat(input.path)
+		if err != nil {
+			statErrs[idx] = err
+			continue
+		}
+		modTimes[idx] = info.ModTime()
+		if modTimes[idx].After(newest) {
+			newest = modTimes[idx]
+		}
+	}
+	upToDate := make([]bool, len(inputs))
+	allUpToDate := true
+	for idx := range inputs {
+		modTime := modTimes[idx]
+		if opts.shared {
+			modTime = newest
+		}
+		upToDate[idx] = !opts.force && statErrs[idx] == nil && outs[idx].upToDate(modTime, q.stages())
+		allUpToDate = allUpToDate && upToDate[idx]
+	}
+
+	errs := make([]error, len(inputs))
+	if opts.shared && (!allUpToDate || opts.keepPalette) {
+		var sharedErrs []error
+		q.palette, sharedErrs, err = q.sharedPalette(inputs, opts.workers)
+		if err != nil {
+			return nil, nil, err
+		}
+		copy(errs, sharedErrs)
+	}
+
+	var mu sync.Mutex
+	skipped := 0
+	processErrs := runPool(len(inputs), opts.workers, func(idx int) error {
+		if errs[idx] != nil {
+			return errs[idx]
+		}
+		if upToDate[idx] {
+			mu.Lock()
+			skipped++
+			mu.Unlock()
+			return nil
+		}
+		_, err := q.process(inputs[idx].path, outs[idx])
+		return err
+	})
+	var failures []error
+	for idx, err := range processErrs {
+		if err != nil {
+			failures = append(failures, err)
+			fmt.Fprintf(os.Stderr, "Failed %s: %s\n", inputs[idx].path, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Processed %d images: %d succeeded, %d up to date, %d failed.\n", len(inputs), len(inputs)-skipped-len(failures), skipped, len(failures))
+	return q.palette, failures, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobRoot(t *testing.T) {
+	for pattern, expect := range map[string]string{
+		"*.jpg":              ".",
+		"in/*.jpg":           "in",
+		"in/photos/*.jpg":    "in/photos",
+		"in/*/cat.jpg":       "in",
+		"in/2024-?/*/*.png":  "in",
+		"in/[ab]/x/*.png":    "in",
+		"/abs/in/*/*.png":    "/abs/in",
+		"/*/cat.png":         "/",
+		"in/photos/cat.jpg":  "in/photos",
+		"in/photos/*/a/b.jp": "in/photos",
+	} {
+		require.Equal(t, expect, globRoot(pattern), pattern)
+	}
+}
+
+func TestFindBatchInputs(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{
+		"a.jpg",
+		"B.PNG",
+		"notes.txt",
+		"sub/b.png",
+		"sub/deeper/c.gif",
+		"out/a_dst.png",
+	} {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+	in := func(path string) string {
+		return filepath.Join(root, path)
+	}
+	outputRoot := in("out")
+
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		expect   []batchInput
+	}{
+		{
+			name:     "directory",
+			patterns: []string{root},
+			expect: []batchInput{
+				{path: in("B.PNG"), outDir: outputRoot},
+				{path: in("a.jpg"), outDir: outputRoot},
+				{path: in("sub/b.png"), outDir: in("out/sub")},
+				{path: in("sub/deeper/c.gif"), outDir: in("out/sub/deeper")},
+			},
+		},
+		{
+			name:     "subdirectory",
+			patterns: []string{in("sub")},
+			expect: []batchInput{
+				{path: in("sub/b.png"), outDir: outputRoot},
+				{path: in("sub/deeper/c.gif"), outDir: in("out/deeper")},
+			},
+		},
+		{
+			name:     "glob",
+			patterns: []string{in("*.jpg")},
+			expect: []batchInput{
+				{path: in("a.jpg"), outDir: outputRoot},
+			},
+		},
+		{
+			name:     "glob with wildcard directory",
+			patterns: []string{in("*/*.png")},
+			expect: []batchInput{
+				{path: in("sub/b.png"), outDir: in("out/sub")},
+			},
+		},
+		{
+			name:     "glob skips directories",
+			patterns: []string{in("sub/*")},
+			expect: []batchInput{
+				{path: in("sub/b.png"), outDir: outputRoot},
+			},
+		},
+		{
+			name:     "overlapping patterns",
+			patterns: []string{in("sub/*.png"), in("sub"), in("a.jpg")},
+			expect: []batchInput{
+				{path: in("a.jpg"), outDir: outputRoot},
+				{path: in("sub/b.png"), outDir: outputRoot},
+				{path: in("sub/deeper/c.gif"), outDir: in("out/deeper")},
+			},
+		},
+		{
+			name:     "output root skipped",
+			patterns: []string{in("out/*.png")},
+			expect:   []batchInput{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := findBatchInputs(tc.patterns, outputRoot)
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+
+	t.Run("no matches", func(t *testing.T) {
+		_, err := findBatchInputs([]string{in("*.webp")}, outputRoot)
+		require.Error(t, err)
+		require.Equal(t, exitProcessing, exitCode(err))
+	})
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := findBatchInputs([]string{in("[")}, outputRoot)
+		require.Error(t, err)
+		require.Equal(t, exitUsage, exitCode(err))
+	})
+}
+
+func TestRunPool(t *testing.T) {
+	errOdd := errors.New("odd")
+	for _, workers := range []int{0, 1, 3, 20} {
+		var calls int32
+		errs := runPool(10, workers, func(idx int) error {
+			atomic.AddInt32(&calls, 1)
+			switch {
+			case idx == 4:
+				panic("four")
+			case idx%2 == 1:
+				return errOdd
+			default:
+				return nil
+			}
+		})
+		require.Equal(t, int32(10), calls, "workers=%d", workers)
+		require.Len(t, errs, 10)
+		for idx, err := range errs {
+			switch {
+			case idx == 4:
+				require.EqualError(t, err, "panic: four")
+			case idx%2 == 1:
+				require.Equal(t, errOdd, err)
+			default:
+				require.NoError(t, err)
+			}
+		}
+	}
+	require.Empty(t, runPool(0, 4, func(int) error {
+		panic("not called")
+	}))
+}
+
+func TestDisambiguateOutputs(t *testing.T) {
+	newBatchOutputs := func(t *testing.T, template string, paths ...string) ([]batchInput, []*outputs) {
+		inputs := make([]batchInput, 0, len(paths))
+		outs := make([]*outputs, 0, len(paths))
+		for _, path := range paths {
+			input := batchInput{path: path, outDir: "out"}
+			out, err := newOutputs(input.path, input.outDir, template, "png", "dst")
+			require.NoError(t, err)
+			inputs = append(inputs, input)
+			outs = append(outs, out)
+		}
+		return inputs, outs
+	}
+	for _, tc := range []struct {
+		name     string
+		template string
+		paths    []string
+		expect   []string
+	}{
+		{
+			name:     "distinct names",
+			template: inputOutputTemplate,
+			paths:    []string{"in/a.png", "in/b.png"},
+			expect:   []string{"out/a_dst.png", "out/b_dst.png"},
+		},
+		{
+			name:     "same name",
+			template: inputOutputTemplate,
+			paths:    []string{"in/a.jpg", "in/a.png", "in/b.png"},
+			expect:   []string{"out/a.jpg_dst.png", "out/a.png_dst.png", "out/b_dst.png"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inputs, outs := newBatchOutputs(t, tc.template, tc.paths...)
+			require.NoError(t, disambiguateOutputs(inputs, outs))
+			actual := make([]string, 0, len(outs))
+			for _, out := range outs {
+				path, ok := out.path(stageDst)
+				require.True(t, ok)
+				actual = append(actual, path)
+			}
+			require.Equal(t, tc.expect, actual)
+		})
+	}
+
+	t.Run("template without name", func(t *testing.T) {
+		inputs, outs := newBatchOutputs(t, "{dir}/{stage}.{ext}", "in/a.png", "in/b.png")
+		err := disambiguateOutputs(inputs, outs)
+		require.Error(t, err)
+		require.Equal(t, exitUsage, exitCode(err))
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// runConvert converts a palette file from one format to another.
+func runConvert(args []string) error {
+	fs := newFlagSet("convert", "--input <palette> --output <palette> [flags]", "Convert a palette file from one format to another. The input format is detected from the extension and content. Names and metadata are kept where the output format supports them.")
+	input := fs.String("input", "", fmt.Sprintf("Palette file to read, or \"-\" to read from stdin. Supported formats: %s", strings.Join(paletteio.Extensions(), ", ")))
+	output := fs.String("output", "", fmt.Sprintf("Palette file to write, or \"-\" to write to stdout. Supported formats: %s", strings.Join(append(paletteio.Extensions(), paletteio.ExportExtensions()...), ", ")))
+	format := fs.String("format", "", fmt.Sprintf("Format of the palette written, instead of that given by the extension of --output. Required when writing to stdout. One of: %s", strings.Join(append(paletteio.FormatNames(), paletteio.ExportFormatNames()...), ", ")))
+	name := fs.String("name", "", "Name of the palette, replacing any name in the input.")
+	naming := addNamingFlags(fs, "output")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *input == "" || *output == "" {
+		return usageError(fs, "--input and --output are required")
+	}
+	p, err := readPalette(*input)
+	if err != nil {
+		return err
+	}
+	if *name != "" {
+		p.Name = *name
+	}
+	// Colors are only named on request, so that unnamed palettes convert
+	// unchanged.
+	if isFlagSet(fs, "color_names") || isFlagSet(fs, "color_naming") {
+		p, err = naming.apply(p)
+		if err != nil {
+			return err
+		}
+	}
+	return writePalette(*output, *format, p)
+}
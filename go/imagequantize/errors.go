@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Exit codes, which allow scripts to tell the kinds of failure apart.
+const (
+	// exitProcessing indicates that an image or palette could not be
+	// processed, or that images in a batch failed for different reasons.
+	exitProcessing = 1
+	// exitUsage indicates missing, conflicting or invalid flags.
+	exitUsage = 2
+	// exitIO indicates that a file could not be read or written.
+	exitIO = 3
+	// exitDecode indicates that an image, palette, map or recipe could not be
+	// decoded.
+	exitDecode = 4
+)
+
+// exitError is an error which causes imagequantize to exit with the given
+// code.
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error implements error.
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err with the given exit code, unless it is nil or
+// already has one.
+func withExitCode(code int, err error) error {
+	var exitErr *exitError
+	if err == nil || errors.As(err, &exitErr) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// invalidUsage marks err as being caused by the command line arguments.
+func invalidUsage(err error) error {
+	return withExitCode(exitUsage, err)
+}
+
+// decodeError describes a failure to decode the named kind of file at the
+// given path, unless err is nil or is a failure to read the file itself.
+func decodeError(kind, path string, err error) error {
+	if err == nil || isIOError(err) {
+		return err
+	}
+	return withExitCode(exitDecode, fmt.Errorf("failed to decode %s %q: %w", kind, path, err))
+}
+
+// isIOError reports whether err was returned by a file system operation.
+func isIOError(err error) bool {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	return errors.As(err, &pathErr) || errors.As(err, &linkErr) || errors.As(err, &syscallErr)
+}
+
+// exitCode returns the code with which imagequantize exits after the given
+// error.
+func exitCode(err error) int {
+	var exitErr *exitError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case isIOError(err):
+		return exitIO
+	default:
+		return exitProcessing
+	}
+}
+
+// batchExitCode returns the exit code shared by every failure in a batch, or
+// exitProcessing if they differ.
+func batchExitCode(errs []error) int {
+	code := exitProcessing
+	for idx, err := range errs {
+		if idx == 0 {
+			code = exitCode(err)
+		} else if exitCode(err) != code {
+			return exitProcessing
+		}
+	}
+	return code
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	_, statErr := os.Stat(filepath.Join(t.TempDir(), "missing.png"))
+	require.Error(t, statErr)
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		expect int
+	}{
+		{"nil", nil, 0},
+		{"help", flag.ErrHelp, 0},
+		{"wrapped help", invalidUsage(fmt.Errorf("parse: %w", flag.ErrHelp)), 0},
+		{"processing", errors.New("no colors"), exitProcessing},
+		{"usage", invalidUsage(errors.New("--input is required")), exitUsage},
+		{"wrapped usage", fmt.Errorf("step 1: %w", invalidUsage(errors.New("bad"))), exitUsage},
+		{"path error", statErr, exitIO},
+		{"wrapped path error", fmt.Errorf("reading input: %w", statErr), exitIO},
+		{"link error", &os.LinkError{Op: "rename", Old: "a", New: "b", Err: fs.ErrExist}, exitIO},
+		{"syscall error", os.NewSyscallError("write", fs.ErrClosed), exitIO},
+		{"decode", decodeError("image", "cat.png", errors.New("unexpected EOF")), exitDecode},
+		{"code overrides I/O", withExitCode(exitDecode, statErr), exitDecode},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, exitCode(tc.err))
+		})
+	}
+}
+
+func TestWithExitCode(t *testing.T) {
+	require.NoError(t, withExitCode(exitIO, nil))
+
+	base := errors.New("bad flag")
+	err := withExitCode(exitUsage, base)
+	require.EqualError(t, err, "bad flag")
+	require.ErrorIs(t, err, base)
+	require.Equal(t, exitUsage, exitCode(err))
+
+	// The first code given is kept.
+	require.Equal(t, exitUsage, exitCode(withExitCode(exitDecode, err)))
+	require.Equal(t, exitUsage, exitCode(withExitCode(exitDecode, fmt.Errorf("wrapped: %w", err))))
+}
+
+func TestDecodeError(t *testing.T) {
+	require.NoError(t, decodeError("image", "cat.png", nil))
+
+	_, statErr := os.Stat(filepath.Join(t.TempDir(), "missing.png"))
+	require.Error(t, statErr)
+	require.Equal(t, statErr, decodeError("image", "cat.png", statErr))
+
+	base := errors.New("unknown format")
+	err := decodeError("palette", "cat.gpl", base)
+	require.EqualError(t, err, `failed to decode palette "cat.gpl": unknown format`)
+	require.ErrorIs(t, err, base)
+	require.Equal(t, exitDecode, exitCode(err))
+}
+
+func TestBatchExitCode(t *testing.T) {
+	usage := invalidUsage(errors.New("usage"))
+	decode := decodeError("image", "a.png", errors.New("bad"))
+	_, statErr := os.Stat(filepath.Join(t.TempDir(), "missing.png"))
+	require.Error(t, statErr)
+
+	for _, tc := range []struct {
+		name   string
+		errs   []error
+		expect int
+	}{
+		{"none", nil, exitProcessing},
+		{"one", []error{decode}, exitDecode},
+		{"shared", []error{statErr, fmt.Errorf("b.png: %w", statErr), statErr}, exitIO},
+		{"shared decode", []error{decode, decodeError("image", "b.png", errors.New("bad"))}, exitDecode},
+		{"differ", []error{decode, statErr}, exitProcessing},
+		{"differ after shared", []error{usage, usage, decode}, exitProcessing},
+		{"processing", []error{errors.New("a"), errors.New("b")}, exitProcessing},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, batchExitCode(tc.errs))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// runExtract creates a palette from an image and writes it to a palette file.
+func runExtract(args []string) error {
+	fs := newFlagSet("extract", "--input <image> --output <palette> [flags]", "Create a palette from an image using the selected algorithm and write it, from darkest to lightest, to a palette file.")
+	input := fs.String("input", "", "Image file from which to create the palette, or \"-\" to read from stdin.")
+	output := fs.String("output", "", fmt.Sprintf("Palette file to write, or \"-\" to write to stdout. Supported formats: %s", strings.Join(append(paletteio.Extensions(), paletteio.ExportExtensions()...), ", ")))
+	format := fs.String("format", "", fmt.Sprintf("Format of the palette written, instead of that given by the extension of --output. Required when writing to stdout. One of: %s", strings.Join(append(paletteio.FormatNames(), paletteio.ExportFormatNames()...), ", ")))
+	name := fs.String("name", "", "Name of the palette. Defaults to the name of the input file.")
+	algFlags := addAlgorithmFlags(fs)
+	naming := addNamingFlags(fs, "output")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *algFlags.listAlgorithms {
+		printAlgorithms()
+		return nil
+	}
+	if *input == "" || *output == "" {
+		return usageError(fs, "--input and --output are required")
+	}
+	alg, algParams, err := algFlags.parse()
+	if err != nil {
+		return err
+	}
+	img, err := readImage(*input)
+	if err != nil {
+		return err
+	}
+	colors, err := alg.Run(img, algParams)
+	if err != nil {
+		return err
+	}
+	p := paletteio.New(palette.SortedByLuminosity(colors))
+	p.Name = *name
+	if p.Name == "" {
+		p.Name = inputName(*input)
+	}
+	named, err := naming.apply(p)
+	if err != nil {
+		return err
+	}
+	return writePalette(*output, *format, named)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// writeFile creates the file at the given path, including any missing parent
+// directories, and calls fn to write its contents. The path "-" writes to
+// stdout instead.
+func writeFile(path string, fn func(w io.Writer) error) (err error) {
+	if path == "-" {
+		return fn(os.Stdout)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := f.Close(); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	if err := fn(f); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Wrote ", path)
+	return nil
+}
+
+// imageFormatFor returns the name of the format in which the image at the given
+// path is written, which is given by its extension if it is that of an image
+// format, or the given format otherwise.
+func imageFormatFor(path, format string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".jpeg" {
+		return "jpeg"
+	}
+	for _, name := range imageFormatNames {
+		if imageFormats[name] == ext {
+			return name
+		}
+	}
+	return format
+}
+
+// writeImage is a convenience function for writing an image in the named
+// format. An image.Paletted is written as an indexed PNG or GIF image with its
+// palette unchanged, so that no colors are lost; other images written as GIF
+// are quantized by the gif package.
+func writeImage(w io.Writer, format string, img image.Image) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{
+			Quality: 100,
+		})
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported image format %q", format)
+	}
+}
+
+// writeImageFile writes the image to the given path, or to stdout for "-", in
+// the format given by the extension or else the named format.
+func writeImageFile(path, format string, img image.Image) error {
+	return writeFile(path, func(w io.Writer) error {
+		return writeImage(w, imageFormatFor(path, format), img)
+	})
+}
+
+// paletted returns the image, whose colors are all in the given palette, as an
+// image.Paletted so that it is written as an indexed image. Palettes which are
+// too large for an image.Paletted are left as they are.
+func paletted(img image.Image, p color.Palette) image.Image {
+	if palette.CheckPalette(p) != nil {
+		return img
+	}
+	return palette.NoDither{}.Dither(img, p)
+}
+
+// readImageFile is a convenience function for reading an Image. The path "-"
+// reads from stdin.
+func readImage(path string) (image.Image, error) {
+	var contents []byte
+	var err error
+	if path == "-" {
+		contents, err = io.ReadAll(os.Stdin)
+	} else {
+		contents, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, decodeError("image", path, err)
+	}
+	return img, nil
+}
+
+// readPalette reads a palette file in any supported format. The path "-"
+// reads from stdin, detecting the format from the content.
+func readPalette(path string) (*paletteio.Palette, error) {
+	var p *paletteio.Palette
+	var err error
+	if path == "-" {
+		p, err = paletteio.Read(os.Stdin)
+	} else {
+		p, err = paletteio.ReadFile(path)
+	}
+	if err != nil {
+		return nil, decodeError("palette", path, err)
+	}
+	return p, nil
+}
+
+// writePalette writes a palette to the given path, or to stdout for "-", in
+// the named format, or else in the format given by the extension.
+func writePalette(path, format string, p *paletteio.Palette) error {
+	if format == "" {
+		if path == "-" {
+			return invalidUsage(fmt.Errorf("a palette format is required to write to stdout"))
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !contains(paletteio.Extensions(), ext) && !contains(paletteio.ExportExtensions(), ext) {
+			return invalidUsage(fmt.Errorf("unsupported palette file extension %q for %q; supported extensions: %s", ext, path, strings.Join(append(paletteio.Extensions(), paletteio.ExportExtensions()...), ", ")))
+		}
+		if err := paletteio.WriteFile(path, p); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrote ", path)
+		return nil
+	}
+	if !contains(paletteio.FormatNames(), format) && !contains(paletteio.ExportFormatNames(), format) {
+		return invalidUsage(fmt.Errorf("unknown palette format %q; known formats: %s", format, strings.Join(append(paletteio.FormatNames(), paletteio.ExportFormatNames()...), ", ")))
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return paletteio.WriteFormat(w, format, p)
+	})
+}
+
+// readThresholdMap is a convenience function for reading a ThresholdMap from
+// an image file.
+func readThresholdMap(path string) (palette.ThresholdMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return palette.ThresholdMap{}, err
+	}
+	defer f.Close()
+	m, err := palette.DecodeThresholdMap(f)
+	if err != nil {
+		return palette.ThresholdMap{}, withExitCode(exitDecode, fmt.Errorf("%s: %w", path, err))
+	}
+	return m, nil
+}
+
+// checkMapPath returns a usage error if a palette Map cannot be written to the
+// given file with the given 3D LUT size, where zero means a 1D LUT.
+func checkMapPath(path string, lutSize int) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".json" && ext != ".png" {
+		return invalidUsage(fmt.Errorf("unsupported palette map file extension for %q; expected .json or .png", path))
+	}
+	if lutSize != 0 {
+		if ext != ".png" {
+			return invalidUsage(fmt.Errorf("--lut_size requires a .png palette map file, not %q", path))
+		}
+		if lutSize < 2 || lutSize > 256 {
+			return invalidUsage(fmt.Errorf("invalid --lut_size %d; must be between 2 and 256", lutSize))
+		}
+	}
+	return nil
+}
+
+// writeMap writes the palette Map to the given file, as JSON or as a LUT PNG
+// image depending on the extension. The image is a 3D LUT with the given size,
+// or a 1D LUT if it is zero.
+func writeMap(path string, m *palette.Map, lutSize int) error {
+	if err := checkMapPath(path, lutSize); err != nil {
+		return err
+	}
+	var lut *image.NRGBA
+	if lutSize != 0 {
+		var err error
+		lut, err = m.LUT3D(lutSize, palette.FallbackNearestSource)
+		if err != nil {
+			return err
+		}
+	} else if strings.ToLower(filepath.Ext(path)) == ".png" {
+		lut = m.LUT1D()
+		if lut.Bounds().Dx() == 4 {
+			// A 1D LUT of four entries has the shape of a 3D LUT of size
+			// two, so repeat the last entry, which reads back unchanged.
+			padded := image.NewNRGBA(image.Rect(0, 0, 5, 2))
+			draw.Draw(padded, lut.Bounds(), lut, image.Point{}, draw.Src)
+			draw.Draw(padded, image.Rect(4, 0, 5, 2), lut, image.Point{X: 3}, draw.Src)
+			lut = padded
+		}
+	}
+	return writeFile(path, func(w io.Writer) error {
+		if lut == nil {
+			return json.NewEncoder(w).Encode(m)
+		}
+		return png.Encode(w, lut)
+	})
+}
+
+// readMap reads a palette Map from the given file, which may be JSON, a 1D LUT
+// image, or a 3D LUT image. Images of size^2 by size pixels are read as 3D
+// LUTs, and other images two pixels tall as 1D LUTs.
+func readMap(path string) (*palette.Map, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		m := palette.NewMap()
+		if err := json.Unmarshal(contents, m); err != nil {
+			return nil, decodeError("palette map", path, err)
+		}
+		return m, nil
+	}
+	img, err := readImage(path)
+	if err != nil {
+		return nil, err
+	}
+	var m *palette.Map
+	if bounds := img.Bounds(); bounds.Dx() != bounds.Dy()*bounds.Dy() && bounds.Dy() == 2 {
+		m, err = palette.MapFromLUT1D(img)
+	} else {
+		m, err = palette.MapFromLUT3D(img)
+	}
+	if err != nil {
+		return nil, decodeError("palette map", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	mapWithColors := func(n int) *palette.Map {
+		m := palette.NewMap()
+		for idx := 0; idx < n; idx++ {
+			v := uint8(idx * 255 / n)
+			m.Set(color.RGBA{R: v, G: v, B: v, A: 255}, color.RGBA{R: v, A: 255})
+		}
+		return m
+	}
+
+	test := func(name string, m *palette.Map, lutSize int, expectLen int) {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, writeMap(path, m, lutSize))
+			actual, err := readMap(path)
+			require.NoError(t, err)
+			require.Equal(t, expectLen, actual.Len())
+			if lutSize == 0 {
+				m.Range(func(src, dst color.Color) {
+					got, ok := actual.Get(src)
+					require.True(t, ok)
+					require.Equal(t, palette.Key(dst), palette.Key(got))
+				})
+			}
+		})
+	}
+	test("map.json", mapWithColors(4), 0, 4)
+	test("lut1d.png", mapWithColors(3), 0, 3)
+	// A 1D LUT of four entries must not be mistaken for a 3D LUT of size 2.
+	test("lut1d4.png", mapWithColors(4), 0, 4)
+	test("lut3d2.png", mapWithColors(4), 2, 8)
+	test("lut3d5.png", mapWithColors(4), 5, 125)
+}
+
+func TestCheckMapPath(t *testing.T) {
+	require.NoError(t, checkMapPath("map.json", 0))
+	require.NoError(t, checkMapPath("map.png", 17))
+	for _, tc := range []struct {
+		path    string
+		lutSize int
+	}{
+		{"map.txt", 0},
+		{"map.json", 17},
+		{"map.png", 1},
+		{"map.png", 257},
+	} {
+		err := checkMapPath(tc.path, tc.lutSize)
+		require.Error(t, err, "%s %d", tc.path, tc.lutSize)
+		require.Equal(t, exitUsage, exitCode(err))
+	}
+}
+
+func TestImageFormatFor(t *testing.T) {
+	for path, expect := range map[string]string{
+		"cat.png":  "png",
+		"cat.JPG":  "jpeg",
+		"cat.jpeg": "jpeg",
+		"cat.gif":  "gif",
+		"cat.webp": "gif",
+		"cat":      "gif",
+	} {
+		require.Equal(t, expect, imageFormatFor(path, "gif"), path)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// newFlagSet returns a FlagSet for the named subcommand, whose help shows the
+// given usage line and description followed by the flags.
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: imagequantize %s %s\n\n%s\n\nFlags:\n", name, usage, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// algorithmFlags are the flags which select and configure the algorithm used
+// to create a palette.
+type algorithmFlags struct {
+	algorithm      *string
+	params         *string
+	listAlgorithms *bool
+	numColors      *int
+	colorSpace     *string
+}
+
+// addAlgorithmFlags registers the algorithm flags with the FlagSet.
+func addAlgorithmFlags(fs *flag.FlagSet) *algorithmFlags {
+	return &algorithmFlags{
+		algorithm:      fs.String("algorithm", "kmeans", "Algorithm used to create the palette. See --list_algorithms."),
+		params:         fs.String("params", "", "Comma-separated key=value parameters for the algorithm, eg. \"colors=8,iterations=100\"."),
+		listAlgorithms: fs.Bool("list_algorithms", false, "List the available algorithms and their parameters, then exit."),
+		numColors:      fs.Int("colors", 0, "Number of colors to use in the palette. Shorthand for the \"colors\" algorithm parameter."),
+		colorSpace:     fs.String("colorspace", "", "Color space in which to build the palette, eg. \"oklab\". Shorthand for the \"colorspace\" algorithm parameter."),
+	}
+}
+
+// parse returns the selected algorithm and its raw parameters.
+func (f *algorithmFlags) parse() (palette.Algorithm, map[string]string, error) {
+	alg, err := palette.GetAlgorithm(*f.algorithm)
+	if err != nil {
+		return palette.Algorithm{}, nil, invalidUsage(err)
+	}
+	algParams, err := palette.ParseParams(*f.params)
+	if err != nil {
+		return palette.Algorithm{}, nil, invalidUsage(err)
+	}
+	if _, ok := algParams["colors"]; !ok && *f.numColors != 0 && alg.HasParam("colors") {
+		algParams["colors"] = strconv.Itoa(*f.numColors)
+	}
+	if _, ok := algParams["colorspace"]; !ok && *f.colorSpace != "" {
+		if !alg.HasParam("colorspace") {
+			return palette.Algorithm{}, nil, invalidUsage(fmt.Errorf("algorithm %q does not support --colorspace", alg.Name))
+		}
+		algParams["colorspace"] = *f.colorSpace
+	}
+	// Check the parameters now, rather than after reading the image.
+	if _, err := alg.ParseArgs(algParams); err != nil {
+		return palette.Algorithm{}, nil, invalidUsage(err)
+	}
+	return alg, algParams, nil
+}
+
+// printAlgorithms writes the registered palette algorithms and their
+// parameters to stdout.
+func printAlgorithms() {
+	for _, alg := range palette.Algorithms() {
+		fmt.Printf("%s: %s\n", alg.Name, alg.Description)
+		for _, param := range alg.Params {
+			def := "required"
+			if param.Default != "" {
+				def = "default " + param.Default
+			}
+			if param.Min != 0 {
+				def += fmt.Sprintf(", at least %d", param.Min)
+			}
+			fmt.Printf("  %s (%s, %s): %s\n", param.Name, param.Type, def, param.Description)
+		}
+	}
+}
+
+// ditherFlags are the flags which select and configure the Ditherer used to
+// apply a palette.
+type ditherFlags struct {
+	dither         *string
+	ditherStrength *float64
+	serpentine     *bool
+	thresholdMap   *string
+}
+
+// addDitherFlags registers the dithering flags with the FlagSet.
+func addDitherFlags(fs *flag.FlagSet) *ditherFlags {
+	return &ditherFlags{
+		dither:         fs.String("dither", "none", fmt.Sprintf("Dithering mode used when applying the palette. One of: %s", strings.Join(palette.DithererNames(), ", "))),
+		ditherStrength: fs.Float64("dither_strength", 1.0, "Strength of the dithering effect."),
+		serpentine:     fs.Bool("serpentine", true, "Alternate the scan direction on each row when using error diffusion dithering."),
+		thresholdMap:   fs.String("threshold_map", "", "Image file containing a custom threshold map for ordered dithering. Implies --dither=threshold-map."),
+	}
+}
+
+// parse returns the selected Ditherer.
+func (f *ditherFlags) parse() (palette.Ditherer, error) {
+	ditherOpts := palette.DitherOptions{
+		Strength:   *f.ditherStrength,
+		Serpentine: *f.serpentine,
+	}
+	dither := *f.dither
+	if *f.thresholdMap != "" {
+		if dither != "none" && dither != "threshold-map" {
+			return nil, invalidUsage(fmt.Errorf("--threshold_map cannot be used with --dither=%s", dither))
+		}
+		m, err := readThresholdMap(*f.thresholdMap)
+		if err != nil {
+			return nil, err
+		}
+		ditherOpts.ThresholdMap = &m
+		if dither == "none" {
+			dither = "threshold-map"
+		}
+	}
+	ditherer, err := palette.NewDitherer(dither, ditherOpts)
+	if err != nil {
+		return nil, invalidUsage(err)
+	}
+	return ditherer, nil
+}
+
+// namingFlags are the flags which name the colors of an exported palette.
+type namingFlags struct {
+	colorNames  *string
+	colorNaming *string
+}
+
+// addNamingFlags registers the naming flags with the FlagSet, for the palette
+// written by the given flag.
+func addNamingFlags(fs *flag.FlagSet, paletteFlag string) *namingFlags {
+	return &namingFlags{
+		colorNames:  fs.String("color_names", "", fmt.Sprintf("Comma-separated names of the colors written to --%s, in palette order. Colors without a name are named using --color_naming.", paletteFlag)),
+		colorNaming: fs.String("color_naming", "index", fmt.Sprintf("How to name the colors written to --%s which are not otherwise named. One of: %s", paletteFlag, strings.Join(paletteio.NamerNames, ", "))),
+	}
+}
+
+// apply returns a copy of the palette with every color named. Names given by
+// --color_names replace any existing names.
+func (f *namingFlags) apply(p *paletteio.Palette) (*paletteio.Palette, error) {
+	namer, err := paletteio.ParseNamer(*f.colorNaming)
+	if err != nil {
+		return nil, invalidUsage(err)
+	}
+	if *f.colorNames != "" {
+		names := strings.Split(*f.colorNames, ",")
+		if len(names) > len(p.Colors) {
+			return nil, invalidUsage(fmt.Errorf("--color_names has %d names but the palette has only %d colors", len(names), len(p.Colors)))
+		}
+		named := *p
+		named.Names = make([]string, len(p.Colors))
+		for idx := range named.Names {
+			if idx < len(names) {
+				named.Names[idx] = names[idx]
+			} else {
+				named.Names[idx] = p.ColorName(idx)
+			}
+		}
+		p = &named
+	}
+	return p.WithNames(namer), nil
+}
+
+// parseFlags parses the arguments with the FlagSet. Any error, other than
+// flag.ErrHelp, is a usage error.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	return invalidUsage(fs.Parse(args))
+}
+
+// usageError prints the FlagSet's usage and returns a usage error describing
+// the problem with its arguments.
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fs.Usage()
+	fmt.Fprintln(os.Stderr)
+	return invalidUsage(fmt.Errorf(format, args...))
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+	"github.com/stretchr/testify/require"
+)
+
+// testFlagSet returns a FlagSet whose usage is discarded.
+func testFlagSet() *flag.FlagSet {
+	fs := newFlagSet("test", "[flags]", "Test command.")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"quantize", "extract", "apply", "remap", "convert", "inspect", "run"} {
+		cmd, ok := findCommand(name)
+		require.True(t, ok, name)
+		require.Equal(t, name, cmd.name)
+		require.NotNil(t, cmd.run, name)
+	}
+	_, ok := findCommand("help")
+	require.False(t, ok)
+	_, ok = findCommand("")
+	require.False(t, ok)
+}
+
+func TestParseFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		expect int
+	}{
+		{"valid", []string{"--colors=4", "--name", "cat"}, 0},
+		{"help", []string{"--help"}, 0},
+		{"unknown flag", []string{"--colour=4"}, exitUsage},
+		{"invalid value", []string{"--colors=four"}, exitUsage},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := testFlagSet()
+			fs.Int("colors", 0, "")
+			fs.String("name", "", "")
+			require.Equal(t, tc.expect, exitCode(parseFlags(fs, tc.args)))
+		})
+	}
+}
+
+func TestIsFlagSet(t *testing.T) {
+	fs := testFlagSet()
+	fs.Bool("serpentine", true, "")
+	fs.Int("colors", 0, "")
+	fs.String("name", "", "")
+	require.NoError(t, parseFlags(fs, []string{"--serpentine=true", "--colors=0"}))
+	// Flags given their default value are still set.
+	require.True(t, isFlagSet(fs, "serpentine"))
+	require.True(t, isFlagSet(fs, "colors"))
+	require.False(t, isFlagSet(fs, "name"))
+	require.False(t, isFlagSet(fs, "unknown"))
+}
+
+func TestUsageError(t *testing.T) {
+	err := usageError(testFlagSet(), "--input is required")
+	require.EqualError(t, err, "--input is required")
+	require.Equal(t, exitUsage, exitCode(err))
+}
+
+func TestAlgorithmFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		expectAlg string
+		expect    map[string]string
+		expectErr string
+	}{
+		{
+			name:      "colors",
+			args:      []string{"--colors=8"},
+			expectAlg: "kmeans",
+			expect:    map[string]string{"colors": "8"},
+		},
+		{
+			name:      "params take precedence",
+			args:      []string{"--colors=8", "--colorspace=oklab", "--params=colors=4,colorspace=cielab"},
+			expectAlg: "kmeans",
+			expect:    map[string]string{"colors": "4", "colorspace": "cielab"},
+		},
+		{
+			name:      "colorspace",
+			args:      []string{"--colors=8", "--colorspace=oklab"},
+			expectAlg: "kmeans",
+			expect:    map[string]string{"colors": "8", "colorspace": "oklab"},
+		},
+		{
+			name:      "colors ignored",
+			args:      []string{"--algorithm=subdivide", "--params=divisions=2", "--colors=8"},
+			expectAlg: "subdivide",
+			expect:    map[string]string{"divisions": "2"},
+		},
+		{
+			name:      "unknown algorithm",
+			args:      []string{"--algorithm=octree"},
+			expectErr: "octree",
+		},
+		{
+			name:      "invalid params",
+			args:      []string{"--params=colors"},
+			expectErr: "colors",
+		},
+		{
+			name:      "missing required param",
+			args:      []string{},
+			expectErr: "colors",
+		},
+		{
+			name:      "invalid param value",
+			args:      []string{"--colors=8", "--colorspace=cmyk"},
+			expectErr: "cmyk",
+		},
+		{
+			name:      "negative colors",
+			args:      []string{"--algorithm=monochrome", "--params=color=#ff0000", "--colors=-1"},
+			expectErr: "must be at least 1",
+		},
+		{
+			name:      "negative divisions",
+			args:      []string{"--algorithm=subdivide", "--params=divisions=-3"},
+			expectErr: "must be at least 1",
+		},
+		{
+			name:      "negative iterations",
+			args:      []string{"--colors=8", "--params=iterations=-1"},
+			expectErr: "must be at least 1",
+		},
+		{
+			name:      "colorspace unsupported",
+			args:      []string{"--algorithm=subdivide", "--params=divisions=2", "--colorspace=oklab"},
+			expectErr: "does not support --colorspace",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := testFlagSet()
+			f := addAlgorithmFlags(fs)
+			require.NoError(t, parseFlags(fs, tc.args))
+			alg, params, err := f.parse()
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectErr)
+				require.Equal(t, exitUsage, exitCode(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectAlg, alg.Name)
+			require.Equal(t, tc.expect, params)
+		})
+	}
+}
+
+func TestDitherFlags(t *testing.T) {
+	thresholdMap := filepath.Join(t.TempDir(), "map.png")
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	for idx := range img.Pix {
+		img.Pix[idx] = uint8(idx * 64)
+	}
+	f, err := os.Create(thresholdMap)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+
+	for _, tc := range []struct {
+		name       string
+		args       []string
+		expectType palette.Ditherer
+		expectErr  string
+	}{
+		{
+			name:       "default",
+			args:       []string{},
+			expectType: palette.NoDither{},
+		},
+		{
+			name:       "threshold map implies mode",
+			args:       []string{"--threshold_map", thresholdMap},
+			expectType: palette.Ordered{},
+		},
+		{
+			name:       "threshold map with its mode",
+			args:       []string{"--dither=threshold-map", "--threshold_map", thresholdMap},
+			expectType: palette.Ordered{},
+		},
+		{
+			name:      "threshold map with another mode",
+			args:      []string{"--dither=bayer8", "--threshold_map", thresholdMap},
+			expectErr: "--threshold_map cannot be used with --dither=bayer8",
+		},
+		{
+			name:      "unknown mode",
+			args:      []string{"--dither=random"},
+			expectErr: "random",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := testFlagSet()
+			f := addDitherFlags(fs)
+			require.NoError(t, parseFlags(fs, tc.args))
+			d, err := f.parse()
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectErr)
+				require.Equal(t, exitUsage, exitCode(err))
+				return
+			}
+			require.NoError(t, err)
+			require.IsType(t, tc.expectType, d)
+		})
+	}
+}
+
+func TestNamingFlags(t *testing.T) {
+	p := paletteio.New(color.Palette{
+		color.RGBA{A: 255},
+		color.RGBA{R: 255, A: 255},
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+	})
+	p.Names = []string{"ink", "", "paper"}
+
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		expect    []string
+		expectErr string
+	}{
+		{
+			name:   "existing names kept",
+			args:   []string{},
+			expect: []string{"ink", "", "paper"},
+		},
+		{
+			name:   "names replaced",
+			args:   []string{"--color_names=black,red"},
+			expect: []string{"black", "red", "paper"},
+		},
+		{
+			name:   "repeated names made unique",
+			args:   []string{"--color_names=paper,paper"},
+			expect: []string{"paper", "paper-2", "paper-3"},
+		},
+		{
+			name:      "too many names",
+			args:      []string{"--color_names=a,b,c,d"},
+			expectErr: "4 names",
+		},
+		{
+			name:      "unknown naming",
+			args:      []string{"--color_naming=pantone"},
+			expectErr: "pantone",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := testFlagSet()
+			f := addNamingFlags(fs, "palette")
+			require.NoError(t, parseFlags(fs, tc.args))
+			named, err := f.apply(p)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectErr)
+				require.Equal(t, exitUsage, exitCode(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, named.Names, len(p.Colors))
+			for idx, expect := range tc.expect {
+				if expect == "" {
+					// Generated by the namer.
+					require.NotEmpty(t, named.Names[idx])
+				} else {
+					require.Equal(t, expect, named.Names[idx])
+				}
+			}
+			// The original palette is unchanged.
+			require.Equal(t, []string{"ink", "", "paper"}, p.Names)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// runInspect reports statistics about a palette file or an image.
+func runInspect(args []string) error {
+	fs := newFlagSet("inspect", "--input <file> [flags]", "Report statistics about a palette file, or about the colors of an image. Images are inspected as images unless --as_palette is given.")
+	input := fs.String("input", "", "Palette or image file to inspect, or \"-\" to read from stdin.")
+	asPalette := fs.Bool("as_palette", false, "Read an image as a swatch image of palette colors, rather than reporting its own statistics.")
+	top := fs.Int("top", 10, "Number of the most common colors of an image to list.")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return usageError(fs, "--input is required")
+	}
+	if *top < 0 {
+		return usageError(fs, "--top must not be negative")
+	}
+	var contents []byte
+	var err error
+	if *input == "-" {
+		contents, err = io.ReadAll(os.Stdin)
+	} else {
+		contents, err = os.ReadFile(*input)
+	}
+	if err != nil {
+		return err
+	}
+	if !*asPalette {
+		if img, format, err := image.Decode(bytes.NewReader(contents)); err == nil {
+			inspectImage(os.Stdout, img, format, *top)
+			return nil
+		}
+	}
+	var p *paletteio.Palette
+	if *input == "-" {
+		p, err = paletteio.Read(bytes.NewReader(contents))
+	} else {
+		p, err = paletteio.ReadFile(*input)
+	}
+	if err != nil {
+		return decodeError("palette", *input, err)
+	}
+	inspectPalette(os.Stdout, p)
+	return nil
+}
+
+// writeColorTable writes a table with a row for each color, giving its hex
+// value, luminosity and OKLCH coordinates followed by the given extra columns.
+func writeColorTable(w io.Writer, colors color.Palette, extraHeader string, extra func(idx int) string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  #\tHex\tLuminosity\tL\tC\tH\t%s\n", extraHeader)
+	for idx, c := range colors {
+		lch := colorspace.ToOKLab(c).LCH()
+		fmt.Fprintf(tw, "  %d\t%s\t%d\t%.3f\t%.3f\t%.1f\t%s\n", idx+1, palette.ColorToHex(c), palette.Luminosity(c), lch.L, lch.C, lch.H, extra(idx))
+	}
+	tw.Flush()
+}
+
+// inspectPalette writes the palette's metadata and colors, and the closest
+// pair of colors, which shows whether any are hard to tell apart.
+func inspectPalette(w io.Writer, p *paletteio.Palette) {
+	if p.Name != "" {
+		fmt.Fprintf(w, "Name: %s\n", p.Name)
+	}
+	if p.Columns != 0 {
+		fmt.Fprintf(w, "Columns: %d\n", p.Columns)
+	}
+	fmt.Fprintf(w, "Colors: %d\n", len(p.Colors))
+	writeColorTable(w, p.Colors, "Name", p.ColorName)
+
+	closest, a, b := math.Inf(1), -1, -1
+	for i := range p.Colors {
+		for j := i + 1; j < len(p.Colors); j++ {
+			if d := colorspace.DeltaEOK(colorspace.ToOKLab(p.Colors[i]), colorspace.ToOKLab(p.Colors[j])); d < closest {
+				closest, a, b = d, i, j
+			}
+		}
+	}
+	if a >= 0 {
+		fmt.Fprintf(w, "Closest colors: %d and %d (OKLab distance %.3f)\n", a+1, b+1, closest)
+	}
+}
+
+// inspectImage writes the image's dimensions, its palette if it is indexed,
+// and its most common colors.
+func inspectImage(w io.Writer, img image.Image, format string, top int) {
+	bounds := img.Bounds()
+	total := bounds.Dx() * bounds.Dy()
+	fmt.Fprintf(w, "Format: %s\n", format)
+	fmt.Fprintf(w, "Size: %dx%d\n", bounds.Dx(), bounds.Dy())
+	if paletted, ok := img.(*image.Paletted); ok {
+		fmt.Fprintf(w, "Indexed: %d palette colors\n", len(paletted.Palette))
+	}
+
+	counts := map[color.NRGBA]int{}
+	translucent := 0
+	var luminosity float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			counts[c]++
+			if c.A != math.MaxUint8 {
+				translucent++
+			}
+			luminosity += float64(palette.Luminosity(c))
+		}
+	}
+	fmt.Fprintf(w, "Distinct colors: %d\n", len(counts))
+	if total == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Translucent pixels: %d (%.1f%%)\n", translucent, 100*float64(translucent)/float64(total))
+	fmt.Fprintf(w, "Mean luminosity: %.1f\n", luminosity/float64(total))
+
+	common := make(color.Palette, 0, len(counts))
+	for c := range counts {
+		common = append(common, c)
+	}
+	sort.Slice(common, func(i, j int) bool {
+		ci, cj := common[i].(color.NRGBA), common[j].(color.NRGBA)
+		if counts[ci] != counts[cj] {
+			return counts[ci] > counts[cj]
+		}
+		return palette.ColorToHex(ci) < palette.ColorToHex(cj)
+	})
+	if len(common) > top {
+		common = common[:top]
+	}
+	if len(common) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Most common colors:\n")
+	writeColorTable(w, common, "Pixels", func(idx int) string {
+		count := counts[common[idx].(color.NRGBA)]
+		return fmt.Sprintf("%d (%.1f%%)", count, 100*float64(count)/float64(total))
+	})
+}
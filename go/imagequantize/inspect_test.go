@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erock2112/kmeans/go/paletteio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectImageTop(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.RGBA{R: uint8(x * 60), A: 255})
+	}
+	for _, tc := range []struct {
+		top    int
+		expect int
+	}{
+		{0, 0},
+		{1, 1},
+		{4, 4},
+		{10, 4},
+	} {
+		var buf bytes.Buffer
+		inspectImage(&buf, img, "png", tc.top)
+		out := buf.String()
+		require.Contains(t, out, "Distinct colors: 4\n")
+		if tc.expect == 0 {
+			require.NotContains(t, out, "Most common colors:")
+			continue
+		}
+		rows := strings.Split(strings.TrimSpace(out[strings.Index(out, "Most common colors:"):]), "\n")
+		// The heading and column headers precede the rows.
+		require.Len(t, rows, tc.expect+2, "top %d", tc.top)
+	}
+}
+
+func TestInspectPaletteClosest(t *testing.T) {
+	p := paletteio.New(color.Palette{
+		color.RGBA{A: 255},
+		color.RGBA{R: 250, G: 250, B: 250, A: 255},
+		color.RGBA{R: 255, A: 255},
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+	})
+	var buf bytes.Buffer
+	inspectPalette(&buf, p)
+	require.Contains(t, buf.String(), "Colors: 4\n")
+	require.Contains(t, buf.String(), "Closest colors: 2 and 4 (OKLab distance 0.015)\n")
+}
+
+func TestRunInspectNegativeTop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "src.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	require.NoError(t, f.Close())
+
+	err = runInspect([]string{"--input", path, "--top=-1"})
+	require.EqualError(t, err, "--top must not be negative")
+	require.Equal(t, exitUsage, exitCode(err))
+}
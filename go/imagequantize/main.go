@@ -1,149 +1,79 @@
 package main
 
 import (
-	"bytes"
-	"flag"
 	"fmt"
-	"image"
-	"image/color"
-	"image/draw"
-	"image/jpeg"
 	"os"
-	"path/filepath"
-
-	"github.com/erock2112/kmeans/go/palette"
+	"strings"
 )
 
-const maxKMeansIterations = 1000
-
-func main() {
-	// Setup.
-	dir := flag.String("dir", "", "Directory containing images. Expect 'src.jpg' to be present.")
-	numColors := flag.Int("colors", 0, "Number of colors to use in the palette.")
-	remapColor := flag.String("remap_color", "", "Hexadecimal color to remap onto, eg. \"#22459E\"")
-	invert := flag.Bool("invert", false, "Invert the image after quantizing.")
-
-	flag.Parse()
-	if *dir == "" {
-		panic("--dir is required.")
-	}
-	if *numColors == 0 {
-		panic("--colors is required.")
-	}
-
-	// Read the image.
-	srcPath := filepath.Join(*dir, "src.jpg") // TODO: No hard-code.
-	srcImage, err := readImage(srcPath)
-	if err != nil {
-		panic(err)
-	}
-	bounds := srcImage.Bounds()
-
-	// Create the color srcPalette.
-	srcPalette := palette.FromImage(srcImage, *numColors, maxKMeansIterations)
-
-	// Write the palette itself to a file.
-	srcPalette = palette.SortedByLuminosity(srcPalette)
-	if err := writePaletteToFile(srcPalette, filepath.Join(*dir, "palette.jpg")); err != nil {
-		panic(err)
-	}
-
-	// Apply the palette to the image.
-	dstImage := image.NewPaletted(bounds.Bounds(), srcPalette)
-	draw.Draw(dstImage, dstImage.Rect, srcImage, bounds.Min, draw.Over)
-	if err := writeJPEG(filepath.Join(*dir, "quantized.jpg"), dstImage); err != nil {
-		panic(err)
-	}
-
-	if *invert {
-		invertedPalette := palette.InvertPalette(srcPalette)
-		mapping, err := palette.MapDirect(srcPalette, invertedPalette)
-		if err != nil {
-			panic(err)
-		}
-		dstImage, err = mapping.Apply(dstImage)
-		if err != nil {
-			panic(err)
-		}
-		if err := writeJPEG(filepath.Join(*dir, "inverted.jpg"), dstImage); err != nil {
-			panic(err)
-		}
-		srcPalette = invertedPalette
-	}
-
-	if *remapColor != "" {
-		remapColorVal, err := palette.HexToColor(*remapColor)
-		if err != nil {
-			panic(err)
-		}
-
-		// Create a new palette.
-		newPalette := palette.Monochrome(remapColorVal, *numColors)
-		newPalette = palette.SortedByLuminosity(newPalette)
-		if err := writePaletteToFile(newPalette, filepath.Join(*dir, "new_palette.jpg")); err != nil {
-			panic(err)
-		}
+// command is a subcommand of imagequantize.
+type command struct {
+	name        string
+	description string
+	// run parses the subcommand's arguments and runs it.
+	run func(args []string) error
+}
 
-		// Map the old palette onto the new.
-		mapping, err := palette.MapByLuminosity(srcPalette, newPalette)
-		if err != nil {
-			panic(err)
-		}
-		dstImage, err = mapping.Apply(dstImage)
-		if err != nil {
-			panic(err)
-		}
-	}
+// commands lists the subcommands in the order in which they are listed in the
+// help.
+var commands = []command{
+	{name: "quantize", description: "Create a palette for an image and quantize the image to it, optionally inverting and remapping the result.", run: runQuantize},
+	{name: "extract", description: "Create a palette from an image and write it to a palette file.", run: runExtract},
+	{name: "apply", description: "Quantize an image to an existing palette.", run: runApply},
+	{name: "remap", description: "Remap the colors of an image from one palette onto another, or using a saved palette map.", run: runRemap},
+	{name: "convert", description: "Convert a palette file from one format to another.", run: runConvert},
+	{name: "inspect", description: "Report statistics about a palette file or an image.", run: runInspect},
+	{name: "run", description: "Run a pipeline described by a YAML or JSON recipe file.", run: runRecipe},
+}
 
-	// Write out the new image.
-	if err := writeJPEG(filepath.Join(*dir, "dst.jpg"), dstImage); err != nil {
-		panic(err)
+// usage prints the list of subcommands.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: imagequantize <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun \"imagequantize help <command>\" or \"imagequantize <command> --help\" for the flags of each command.\nIf the first argument is a flag, the quantize command is run.\n\nExit codes:\n  %d  success\n  %d  an image or palette could not be processed\n  %d  missing or invalid flags\n  %d  a file could not be read or written\n  %d  an image, palette, map or recipe could not be decoded\nIf images in a batch fail, the exit code is that shared by every failure, or %d if they differ.\n", 0, exitProcessing, exitUsage, exitIO, exitDecode, exitProcessing)
 }
 
-func writePaletteToFile(palette color.Palette, path string) error {
-	const palettePixels = 50
-	paletteImage := image.NewRGBA(image.Rect(0, 0, palettePixels, palettePixels*len(palette)))
-	for idx, color := range palette {
-		yOffset := idx * palettePixels
-		for x := 0; x < palettePixels; x++ {
-			for y := yOffset; y < yOffset+palettePixels; y++ {
-				paletteImage.Set(x, y, color)
-			}
+// findCommand returns the named subcommand.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
 	}
-	return writeJPEG(path, paletteImage)
+	return command{}, false
 }
 
-// writeJPEG is a convenience function for writing a JPEG image.
-func writeJPEG(path string, img image.Image) (err error) {
-	f, err := os.Create(path)
-	if err != nil {
-		panic(err)
+func main() {
+	args := os.Args[1:]
+	// For compatibility, flags without a subcommand run the full pipeline.
+	name := "quantize"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) == 0 {
+		usage()
+		os.Exit(exitUsage)
 	}
-	defer func() {
-		if err2 := f.Close(); err2 != nil && err == nil {
-			err = err2
+	if name == "help" {
+		if len(args) == 0 {
+			usage()
+			return
 		}
-	}()
-	if err := jpeg.Encode(f, img, &jpeg.Options{
-		Quality: 100,
-	}); err != nil {
-		return err
+		name, args = args[0], []string{"--help"}
 	}
-	fmt.Println("Wrote ", path)
-	return nil
-}
-
-// readImageFile is a convenience function for reading an Image.
-func readImage(path string) (image.Image, error) {
-	contents, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", name)
+		usage()
+		os.Exit(exitUsage)
 	}
-	img, _, err := image.Decode(bytes.NewReader(contents))
-	if err != nil {
-		return nil, err
+	// Bugs are reported like any other error, rather than as a stack trace.
+	err := recoverError(func() error {
+		return cmd.run(args)
+	})
+	if code := exitCode(err); code != 0 {
+		fmt.Fprintf(os.Stderr, "imagequantize %s: %s\n", cmd.name, err)
+		os.Exit(code)
 	}
-	return img, nil
 }
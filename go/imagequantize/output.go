@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// The stages of processing whose results may be written.
+const (
+	stagePalette    = "palette"
+	stageQuantized  = "quantized"
+	stageInverted   = "inverted"
+	stageNewPalette = "new_palette"
+	stageDst        = "dst"
+)
+
+// stageNames lists the stages in the order in which they are produced.
+var stageNames = []string{stagePalette, stageQuantized, stageInverted, stageNewPalette, stageDst}
+
+// imageFormats maps the names accepted by --format to the extensions of the
+// files written.
+var imageFormats = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+}
+
+// imageFormatNames lists the names accepted by --format.
+var imageFormatNames = []string{"jpeg", "png", "gif"}
+
+// Default templates for --output, used with and without --dir respectively.
+const (
+	dirOutputTemplate   = "{dir}/{stage}.{ext}"
+	inputOutputTemplate = "{dir}/{name}_{stage}.{ext}"
+)
+
+// templateVars lists the variables which may be used in --output.
+var templateVars = []string{"{dir}", "{name}", "{stage}", "{ext}"}
+
+// outputs determines where, and in which format, each stage is written.
+type outputs struct {
+	// template is the --output template, or "-" for stdout.
+	template string
+	// format is the name of the format used when the path does not have a
+	// known image extension.
+	format string
+	// dir and name are substituted for {dir} and {name} in the template.
+	dir, name string
+	// stages holds the stages to write.
+	stages map[string]bool
+}
+
+// newOutputs validates the output flags. The {dir} variable is the given
+// directory, or the directory containing the input if it is empty, and {name}
+// is the name of the input file without its extension.
+func newOutputs(input, dir, template, format, stages string) (*outputs, error) {
+	if _, ok := imageFormats[format]; !ok {
+		return nil, invalidUsage(fmt.Errorf("unknown --format %q; expected one of: %s", format, strings.Join(imageFormatNames, ", ")))
+	}
+	rv := &outputs{
+		template: template,
+		format:   format,
+		dir:      dir,
+		name:     inputName(input),
+		stages:   map[string]bool{},
+	}
+	if rv.dir == "" {
+		rv.dir = filepath.Dir(input)
+	}
+	if rv.template == "" {
+		rv.template = inputOutputTemplate
+		if dir != "" {
+			rv.template = dirOutputTemplate
+		}
+	}
+	if stages == "" {
+		stages = strings.Join(stageNames, ",")
+		if rv.template == "-" {
+			stages = stageDst
+		}
+	}
+	for _, stage := range strings.Split(stages, ",") {
+		if !contains(stageNames, stage) {
+			return nil, invalidUsage(fmt.Errorf("unknown stage %q; expected one of: %s", stage, strings.Join(stageNames, ", ")))
+		}
+		rv.stages[stage] = true
+	}
+	if len(rv.stages) > 1 {
+		if rv.template == "-" {
+			return nil, invalidUsage(fmt.Errorf("only one stage may be written to stdout, but --stages selects %d", len(rv.stages)))
+		}
+		if !strings.Contains(rv.template, "{stage}") {
+			return nil, invalidUsage(fmt.Errorf("--output must contain {stage} when writing more than one stage"))
+		}
+	}
+	return rv, nil
+}
+
+// inputName returns the name of the input file without its directory or
+// extension, or "stdin" for "-".
+func inputName(input string) string {
+	if input == "-" {
+		return "stdin"
+	}
+	return strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+}
+
+// contains reports whether the slice contains the string.
+func contains(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the path to which the given stage is written, and false if it
+// is not written at all.
+func (o *outputs) path(stage string) (string, bool) {
+	if !o.stages[stage] {
+		return "", false
+	}
+	if o.template == "-" {
+		return "-", true
+	}
+	ext := strings.TrimPrefix(imageFormats[o.format], ".")
+	return strings.NewReplacer("{dir}", o.dir, "{name}", o.name, "{stage}", stage, "{ext}", ext).Replace(o.template), true
+}
+
+// write calls fn to write the given stage, if it is selected, to its file or
+// to stdout, in the format given by the path or else by --format.
+func (o *outputs) write(stage string, fn func(w io.Writer, format string) error) error {
+	path, ok := o.path(stage)
+	if !ok {
+		return nil
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return fn(w, imageFormatFor(path, o.format))
+	})
+}
+
+// writeImage writes the image for the given stage, if it is selected.
+func (o *outputs) writeImage(stage string, img image.Image) error {
+	return o.write(stage, func(w io.Writer, format string) error {
+		return writeImage(w, format, img)
+	})
+}
+
+// writePalette writes the palette for the given stage as a swatch image, which
+// may be read back with --remap_palette, if the stage is selected.
+func (o *outputs) writePalette(stage string, p color.Palette) error {
+	return o.write(stage, func(w io.Writer, format string) error {
+		return paletteio.WriteFormat(w, format, paletteio.New(p))
+	})
+}
+
+// upToDate reports whether every one of the given stages which is selected has
+// been written more recently than the given time, at which its inputs were
+// last modified.
+func (o *outputs) upToDate(modTime time.Time, stages []string) bool {
+	for _, stage := range stages {
+		path, ok := o.path(stage)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Before(modTime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOutputs(t *testing.T) {
+	type expectPaths map[string]string
+	for _, tc := range []struct {
+		name     string
+		input    string
+		dir      string
+		template string
+		format   string
+		stages   string
+		expect   expectPaths
+	}{
+		{
+			name:   "defaults",
+			input:  "in/cat.jpg",
+			format: "png",
+			expect: expectPaths{
+				stagePalette:    "in/cat_palette.png",
+				stageQuantized:  "in/cat_quantized.png",
+				stageInverted:   "in/cat_inverted.png",
+				stageNewPalette: "in/cat_new_palette.png",
+				stageDst:        "in/cat_dst.png",
+			},
+		},
+		{
+			name:   "dir",
+			input:  "in/cat.jpg",
+			dir:    "out",
+			format: "jpeg",
+			stages: "palette,dst",
+			expect: expectPaths{
+				stagePalette: "out/palette.jpg",
+				stageDst:     "out/dst.jpg",
+			},
+		},
+		{
+			name:     "template",
+			input:    "in/cat.jpg",
+			dir:      "out",
+			template: "{dir}/{stage}/{name}.{ext}",
+			format:   "gif",
+			stages:   "quantized,dst",
+			expect: expectPaths{
+				stageQuantized: "out/quantized/cat.gif",
+				stageDst:       "out/dst/cat.gif",
+			},
+		},
+		{
+			name:     "single stage without {stage}",
+			input:    "cat.jpg",
+			template: "{name}-small.{ext}",
+			format:   "png",
+			stages:   "dst",
+			expect: expectPaths{
+				stageDst: "cat-small.png",
+			},
+		},
+		{
+			name:     "stdout",
+			input:    "-",
+			template: "-",
+			format:   "png",
+			expect: expectPaths{
+				stageDst: "-",
+			},
+		},
+		{
+			name:     "stdin",
+			input:    "-",
+			template: "{dir}/{name}_{stage}.{ext}",
+			format:   "png",
+			stages:   "dst",
+			expect: expectPaths{
+				stageDst: "./stdin_dst.png",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := newOutputs(tc.input, tc.dir, tc.template, tc.format, tc.stages)
+			require.NoError(t, err)
+			for _, stage := range stageNames {
+				path, ok := o.path(stage)
+				expect, written := tc.expect[stage]
+				require.Equal(t, written, ok, stage)
+				require.Equal(t, expect, path, stage)
+			}
+		})
+	}
+}
+
+func TestNewOutputsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		template string
+		format   string
+		stages   string
+	}{
+		{"unknown format", "", "bmp", ""},
+		{"unknown stage", "", "png", "dst,thumbnail"},
+		{"stdout with two stages", "-", "png", "palette,dst"},
+		{"two stages without {stage}", "{name}.{ext}", "png", "palette,dst"},
+		{"all stages without {stage}", "{name}.{ext}", "png", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newOutputs("cat.jpg", "", tc.template, tc.format, tc.stages)
+			require.Error(t, err)
+			require.Equal(t, exitUsage, exitCode(err))
+		})
+	}
+}
+
+func TestInputName(t *testing.T) {
+	for input, expect := range map[string]string{
+		"-":                "stdin",
+		"cat.jpg":          "cat",
+		"in/cat.tar.gz":    "cat.tar",
+		"in/cat":           "cat",
+		"/abs/dir/cat.JPG": "cat",
+	} {
+		require.Equal(t, expect, inputName(input), input)
+	}
+}
+
+func TestOutputsUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	o, err := newOutputs(filepath.Join(dir, "cat.jpg"), "", "", "png", "palette,dst")
+	require.NoError(t, err)
+	stages := []string{stagePalette, stageQuantized, stageDst}
+	modTime := time.Now().Add(-time.Hour)
+
+	// Neither selected stage has been written.
+	require.False(t, o.upToDate(modTime, stages))
+
+	write := func(stage string, mtime time.Time) {
+		path, ok := o.path(stage)
+		require.True(t, ok)
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	write(stagePalette, modTime.Add(time.Minute))
+	require.False(t, o.upToDate(modTime, stages))
+	// Stages which are not produced need not exist.
+	require.True(t, o.upToDate(modTime, []string{stagePalette, stageQuantized}))
+
+	// The quantized stage is not selected, so it is never checked.
+	write(stageDst, modTime.Add(time.Minute))
+	require.True(t, o.upToDate(modTime, stages))
+
+	// An output older than its inputs is stale.
+	write(stageDst, modTime.Add(-time.Minute))
+	require.False(t, o.upToDate(modTime, stages))
+
+	// Stdout is never up to date.
+	stdout, err := newOutputs("cat.jpg", "", "-", "png", "")
+	require.NoError(t, err)
+	require.False(t, stdout.upToDate(modTime, stages))
+}
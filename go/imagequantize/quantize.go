@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+)
+
+// runQuantize runs the full pipeline: it creates a palette for each image,
+// quantizes the image to it, and optionally inverts and remaps the result.
+func runQuantize(args []string) error {
+	fs := newFlagSet("quantize", "[flags]", "Create a palette for an image, quantize the image to it, and optionally invert the result or remap it onto another palette. This is the default when no subcommand is given.")
+	dir := fs.String("dir", "", "Directory containing images. Unless --input is given, expect 'src.jpg' to be present. Outputs are written to this directory by default.")
+	input := fs.String("input", "", "Image file to quantize, or \"-\" to read from stdin. Defaults to 'src.jpg' in --dir.")
+	output := fs.String("output", "", fmt.Sprintf("Template for the paths of the files written, or \"-\" to write a single stage to stdout. The template may include %s. Defaults to %q with --dir, or %q otherwise.", strings.Join(templateVars, ", "), dirOutputTemplate, inputOutputTemplate))
+	stages := fs.String("stages", "", fmt.Sprintf("Comma-separated stages to write. Defaults to all stages, or only \"dst\" when writing to stdout. Stages: %s", strings.Join(stageNames, ", ")))
+	algFlags := addAlgorithmFlags(fs)
+	remapColor := fs.String("remap_color", "", "Hexadecimal color to remap onto, eg. \"#22459E\"")
+	remapPalette := fs.String("remap_palette", "", fmt.Sprintf("Palette file to remap onto instead of --remap_color. Supported formats: %s", strings.Join(paletteio.Extensions(), ", ")))
+	exportPalette := fs.String("export_palette", "", fmt.Sprintf("File to which the extracted palette is exported, from darkest to lightest. Supported formats: %s", strings.Join(append(paletteio.Extensions(), paletteio.ExportExtensions()...), ", ")))
+	naming := addNamingFlags(fs, "export_palette")
+	saveMap := fs.String("save_map", "", "File to which the palette map used for --remap_color or --remap_palette is saved, as JSON (.json) or a LUT image (.png).")
+	lutSize := fs.Int("lut_size", 0, "Save --save_map images as 3D LUTs which sample the RGB cube at this many points along each axis, rather than as 1D LUTs.")
+	loadMap := fs.String("load_map", "", "Palette map to apply instead of --remap_color or --remap_palette, as saved by --save_map or a 3D LUT image.")
+	mapStrategy := fs.String("map_strategy", "luminosity", fmt.Sprintf("Strategy used to map the palette onto the one given by --remap_color or --remap_palette. One of: %s", strings.Join(palette.MapStrategyNames, ", ")))
+	softRecolor := fs.Bool("soft_recolor", false, "Recolor the source image by blending the palette changes made by --remap_color or --remap_palette, rather than replacing each pixel with a single palette color.")
+	outputFormat := fs.String("format", "png", fmt.Sprintf("Format of the images written, unless given by the extension in --output. Quantized images are written with their exact palette as indexed PNG or GIF images. One of: %s", strings.Join(imageFormatNames, ", ")))
+	invert := fs.Bool("invert", false, "Invert the image after quantizing.")
+	ditherFlags := addDitherFlags(fs)
+	batch := fs.String("batch", "", "Comma-separated directories, which are searched recursively for images, or glob patterns such as \"photos/*.png\". Each image is quantized, using --jobs concurrent workers, and its results are written into a tree under --output_dir which mirrors the inputs; inputs whose names differ only by extension keep it in {name}. Images whose results are newer than they are are skipped unless --force is given.")
+	outputDir := fs.String("output_dir", "", "Root of the output tree written by --batch.")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Number of images processed concurrently by --batch.")
+	sharedPalette := fs.Bool("shared_palette", false, "Build one palette from a sample of every --batch image and use it for all of them.")
+	force := fs.Bool("force", false, "Process --batch images even if their results are up to date.")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *algFlags.listAlgorithms {
+		printAlgorithms()
+		return nil
+	}
+	batchMode := *batch != ""
+	if batchMode {
+		if *dir != "" || *input != "" {
+			return usageError(fs, "--batch cannot be used with --dir or --input")
+		}
+		if *outputDir == "" {
+			return usageError(fs, "--batch requires --output_dir")
+		}
+		if *saveMap != "" {
+			return usageError(fs, "--save_map cannot be used with --batch")
+		}
+		if *exportPalette != "" && !*sharedPalette {
+			return usageError(fs, "--export_palette requires --shared_palette when used with --batch")
+		}
+	} else if *dir == "" && *input == "" {
+		return usageError(fs, "--dir, --input or --batch is required")
+	}
+	if *saveMap != "" {
+		if err := checkMapPath(*saveMap, *lutSize); err != nil {
+			return err
+		}
+	} else if *lutSize != 0 {
+		return usageError(fs, "--lut_size requires --save_map")
+	}
+	remapModes := 0
+	for _, flagValue := range []string{*remapColor, *remapPalette, *loadMap} {
+		if flagValue != "" {
+			remapModes++
+		}
+	}
+	if remapModes > 1 {
+		return usageError(fs, "--remap_color, --remap_palette and --load_map are mutually exclusive")
+	}
+	if *softRecolor && *remapColor == "" && *remapPalette == "" {
+		return usageError(fs, "--soft_recolor requires --remap_color or --remap_palette")
+	}
+	strategy, err := palette.ParseMapStrategy(*mapStrategy)
+	if err != nil {
+		return invalidUsage(err)
+	}
+	ditherer, err := ditherFlags.parse()
+	if err != nil {
+		return err
+	}
+	alg, algParams, err := algFlags.parse()
+	if err != nil {
+		return err
+	}
+	q := &quantizer{
+		alg:         alg,
+		algParams:   algParams,
+		ditherer:    ditherer,
+		strategy:    strategy,
+		invert:      *invert,
+		softRecolor: *softRecolor,
+		saveMap:     *saveMap,
+		lutSize:     *lutSize,
+	}
+	if *remapPalette != "" {
+		p, err := readPalette(*remapPalette)
+		if err != nil {
+			return err
+		}
+		q.remapPalette = p.Colors
+	} else if *remapColor != "" {
+		q.remapColor, err = palette.HexToColor(*remapColor)
+		if err != nil {
+			return invalidUsage(fmt.Errorf("invalid --remap_color: %w", err))
+		}
+	} else if *loadMap != "" {
+		q.loadedMap, err = readMap(*loadMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	var srcPalette color.Palette
+	var failures []error
+	paletteName := filepath.Base(*dir)
+	if batchMode {
+		srcPalette, failures, err = q.runBatch(batchOptions{
+			patterns:    strings.Split(*batch, ","),
+			outputRoot:  *outputDir,
+			workers:     *jobs,
+			shared:      *sharedPalette,
+			keepPalette: *exportPalette != "",
+			force:       *force,
+			template:    *output,
+			format:      *outputFormat,
+			stages:      *stages,
+		})
+		if err != nil {
+			return err
+		}
+		paletteName = filepath.Base(*outputDir)
+	} else {
+		srcPath := *input
+		if srcPath == "" {
+			srcPath = filepath.Join(*dir, "src.jpg")
+		}
+		out, err := newOutputs(srcPath, *dir, *output, *outputFormat, *stages)
+		if err != nil {
+			return err
+		}
+		srcPalette, err = q.process(srcPath, out)
+		if err != nil {
+			return err
+		}
+		if *dir == "" {
+			paletteName = out.name
+		}
+	}
+
+	if *exportPalette != "" {
+		p := paletteio.New(palette.SortedByLuminosity(srcPalette))
+		p.Name = paletteName
+		named, err := naming.apply(p)
+		if err != nil {
+			return err
+		}
+		if err := writePalette(*exportPalette, "", named); err != nil {
+			return err
+		}
+	}
+	if len(failures) > 0 {
+		return withExitCode(batchExitCode(failures), fmt.Errorf("%d images failed", len(failures)))
+	}
+	return nil
+}
+
+// quantizer holds the settings and shared inputs used to process each image.
+// It is not modified by process, so one quantizer may process several images
+// concurrently.
+type quantizer struct {
+	alg       palette.Algorithm
+	algParams map[string]string
+	ditherer  palette.Ditherer
+	strategy  palette.MapStrategy
+	invert    bool
+	// remapColor, remapPalette and loadedMap are mutually exclusive, and
+	// nil unless given.
+	remapColor   color.Color
+	remapPalette color.Palette
+	loadedMap    *palette.Map
+	softRecolor  bool
+	// saveMap is the path to which the map onto remapColor or remapPalette
+	// is written, if any.
+	saveMap string
+	// lutSize is the size of the 3D LUT written to saveMap, or zero for a 1D
+	// LUT.
+	lutSize int
+	// palette, if non-nil, is used for every image instead of running alg.
+	palette color.Palette
+}
+
+// stages returns the stages which process produces with these settings.
+func (q *quantizer) stages() []string {
+	rv := []string{stagePalette, stageQuantized}
+	if q.invert {
+		rv = append(rv, stageInverted)
+	}
+	if q.remapColor != nil || q.remapPalette != nil {
+		rv = append(rv, stageNewPalette)
+	}
+	return append(rv, stageDst)
+}
+
+// process quantizes the image at srcPath and writes the results of each stage
+// to out. It returns the palette used, sorted by luminosity.
+func (q *quantizer) process(srcPath string, out *outputs) (color.Palette, error) {
+	// Read the image.
+	srcImage, err := readImage(srcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the color srcPalette.
+	srcPalette := q.palette
+	if srcPalette == nil {
+		srcPalette, err = q.alg.Run(srcImage, q.algParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := palette.CheckPalette(srcPalette); err != nil {
+		return nil, err
+	}
+
+	// Write the palette itself to a file.
+	srcPalette = palette.SortedByLuminosity(srcPalette)
+	if err := out.writePalette(stagePalette, srcPalette); err != nil {
+		return nil, err
+	}
+	usedPalette := srcPalette
+
+	// Apply the palette to the image.
+	dstImage := q.ditherer.Dither(srcImage, srcPalette)
+	if err := out.writeImage(stageQuantized, dstImage); err != nil {
+		return nil, err
+	}
+
+	// Palette changes are tracked by index, so that --soft_recolor can apply
+	// them to the source image.
+	origPalette := srcPalette
+	var dstOut image.Image
+	if q.invert {
+		invertedPalette := palette.InvertPalette(srcPalette)
+		mapping, err := palette.MapDirect(srcPalette, invertedPalette)
+		if err != nil {
+			return nil, err
+		}
+		dstImage, err = mapping.Apply(dstImage)
+		if err != nil {
+			return nil, err
+		}
+		if err := out.writeImage(stageInverted, dstImage); err != nil {
+			return nil, err
+		}
+		srcPalette = invertedPalette
+	}
+
+	if q.remapColor != nil || q.remapPalette != nil {
+		// Create a new palette.
+		newPalette := q.remapPalette
+		if newPalette == nil {
+			newPalette = palette.Monochrome(q.remapColor, len(srcPalette))
+		}
+		newPalette = palette.SortedByLuminosity(newPalette)
+		if err := out.writePalette(stageNewPalette, newPalette); err != nil {
+			return nil, err
+		}
+
+		// Map the old palette onto the new.
+		mapping, err := q.strategy(srcPalette, newPalette)
+		if err != nil {
+			return nil, err
+		}
+		if q.softRecolor {
+			newColors := make(color.Palette, 0, len(srcPalette))
+			for _, c := range srcPalette {
+				newColor, _ := mapping.Get(c)
+				newColors = append(newColors, newColor)
+			}
+			dstOut, err = palette.Recolor(srcImage, origPalette, newColors, 0)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			dstImage, err = mapping.Apply(dstImage)
+			if err != nil {
+				return nil, err
+			}
+			dstOut = dstImage
+		}
+		if q.saveMap != "" {
+			if err := writeMap(q.saveMap, mapping, q.lutSize); err != nil {
+				return nil, err
+			}
+		}
+	} else if q.loadedMap != nil {
+		// The saved map may have been built from a different palette, so map
+		// each color through its nearest source color.
+		mapped, err := q.loadedMap.ApplyImage(dstImage, palette.FallbackNearestSource)
+		if err != nil {
+			return nil, err
+		}
+		dstOut = paletted(mapped, q.loadedMap.Palette())
+	} else {
+		dstOut = dstImage
+	}
+
+	// Write out the new image.
+	if err := out.writeImage(stageDst, dstOut); err != nil {
+		return nil, err
+	}
+	return usedPalette, nil
+}
+
+// recoverError calls fn, converting any panic into an error, so that a bug
+// triggered by one image in a batch does not abort the others.
+func recoverError(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
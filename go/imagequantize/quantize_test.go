@@ -0,0 +1,40 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunQuantizeDefaultFormat(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+	input := filepath.Join(dir, "src.png")
+	f, err := os.Create(input)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+
+	require.NoError(t, runQuantize([]string{"--input", input, "--colors=4", "--invert", "--stages=quantized,inverted,dst"}))
+	// Palette-exact stages are written losslessly, with their palette.
+	for _, stage := range []string{stageQuantized, stageInverted, stageDst} {
+		f, err := os.Open(filepath.Join(dir, "src_"+stage+".png"))
+		require.NoError(t, err, stage)
+		actual, err := png.Decode(f)
+		require.NoError(t, f.Close())
+		require.NoError(t, err, stage)
+		paletted, ok := actual.(*image.Paletted)
+		require.True(t, ok, "%s is %T", stage, actual)
+		require.Len(t, paletted.Palette, 4, stage)
+	}
+}
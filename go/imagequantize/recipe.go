@@ -0,0 +1,534 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+	"github.com/erock2112/kmeans/go/paletteio"
+	"gopkg.in/yaml.v3"
+)
+
+// exampleRecipe is shown in the help for the run command.
+const exampleRecipe = `input: photo.jpg
+steps:
+  - step: extract
+    algorithm: kmeans
+    colors: 6
+    colorspace: oklab
+  - step: sort
+    key: lightness
+  - step: write_palette
+    path: "{dir}/{name}_palette.gpl"
+  - step: dither
+    dither: floyd-steinberg
+    strength: 0.8
+  - step: write
+    path: "{dir}/{name}_quantized.png"
+  - step: duotone
+    from: "#1b1b3a"
+    to: "#f5c542"
+  - step: map
+    strategy: lightness
+  - step: write
+    path: "{dir}/{name}_duotone.png"`
+
+// recipeStepNames lists the steps which may be used in a recipe.
+var recipeStepNames = []string{"extract", "load_palette", "sort", "dither", "invert", "monochrome", "duotone", "load_target", "map", "write", "write_palette"}
+
+// recipeStepFields lists the fields, besides "step", which each step accepts.
+var recipeStepFields = map[string][]string{
+	"extract":       {"algorithm", "params", "colors", "colorspace"},
+	"load_palette":  {"path"},
+	"sort":          {"key", "target"},
+	"dither":        {"dither", "strength", "serpentine", "threshold_map"},
+	"invert":        {},
+	"monochrome":    {"color", "steps"},
+	"duotone":       {"from", "to", "steps"},
+	"load_target":   {"path"},
+	"map":           {"strategy", "soft"},
+	"write":         {"path", "format"},
+	"write_palette": {"path", "format", "target"},
+}
+
+// recipe is a pipeline of steps, read from a YAML or JSON file, which is
+// applied to an image.
+type recipe struct {
+	// Input is the image to process. It may be overridden on the command
+	// line.
+	Input string       `yaml:"input"`
+	Steps []recipeStep `yaml:"steps"`
+}
+
+// recipeStep is a single step of a recipe. Step gives its type, and only the
+// fields used by that type may be set.
+type recipeStep struct {
+	Step string `yaml:"step"`
+
+	// Used by extract.
+	Algorithm  string            `yaml:"algorithm"`
+	Params     map[string]string `yaml:"params"`
+	Colors     int               `yaml:"colors"`
+	Colorspace string            `yaml:"colorspace"`
+
+	// Used by sort.
+	Key string `yaml:"key"`
+
+	// Used by dither.
+	Dither       string   `yaml:"dither"`
+	Strength     *float64 `yaml:"strength"`
+	Serpentine   *bool    `yaml:"serpentine"`
+	ThresholdMap string   `yaml:"threshold_map"`
+
+	// Used by monochrome and duotone.
+	Color string `yaml:"color"`
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+	Count int    `yaml:"steps"`
+
+	// Used by map.
+	Strategy string `yaml:"strategy"`
+	Soft     bool   `yaml:"soft"`
+
+	// Path is used by load_palette, load_target, write and write_palette,
+	// and Format by write and write_palette.
+	Path   string `yaml:"path"`
+	Format string `yaml:"format"`
+	// Target makes sort and write_palette use the target palette.
+	Target bool `yaml:"target"`
+}
+
+// recipeState is the state of the image and palettes as a recipe runs.
+type recipeState struct {
+	// name and dir are substituted for {name} and {dir} in paths.
+	name, dir string
+	// source is the input image, and image is the current result.
+	source, image image.Image
+	// original is the palette created by the last extract or load_palette
+	// step. palette is the current palette, which has changed from original
+	// index by index through any invert and map steps, so that the changes
+	// may be applied to the source image by a soft map.
+	original, palette color.Palette
+	// target is the palette onto which the next map step maps palette.
+	target color.Palette
+}
+
+// recipeAction applies a compiled recipe step to the state.
+type recipeAction func(st *recipeState) error
+
+// readRecipe reads a recipe from a YAML or JSON file. Unknown fields are
+// errors, so that misspelled parameters are not silently ignored.
+func readRecipe(r io.Reader) (*recipe, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	rv := &recipe{}
+	if err := dec.Decode(rv); err != nil {
+		return nil, err
+	}
+	if len(rv.Steps) == 0 {
+		return nil, fmt.Errorf("recipe has no steps")
+	}
+	return rv, nil
+}
+
+// compile checks every step of the recipe and returns the actions which apply
+// them, so that mistakes are found before any processing is done. This
+// includes steps which use the palette or the target palette before any step
+// has created it.
+func (r *recipe) compile() ([]recipeAction, error) {
+	rv := make([]recipeAction, 0, len(r.Steps))
+	hasPalette, hasTarget := false, false
+	for idx, step := range r.Steps {
+		action, err := step.compile()
+		if err == nil {
+			needPalette, needTarget := step.uses()
+			if needPalette && !hasPalette {
+				err = fmt.Errorf("no palette; add an extract or load_palette step first")
+			} else if needTarget && !hasTarget {
+				err = fmt.Errorf("no target palette; add a monochrome, duotone or load_target step first")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", idx+1, step.Step, err)
+		}
+		switch step.Step {
+		case "extract", "load_palette":
+			hasPalette = true
+		case "monochrome", "duotone", "load_target":
+			hasTarget = true
+		}
+		rv = append(rv, action)
+	}
+	return rv, nil
+}
+
+// uses returns whether the step uses the current palette and the target
+// palette.
+func (s recipeStep) uses() (usesPalette, usesTarget bool) {
+	switch s.Step {
+	case "sort", "write_palette":
+		return !s.Target, s.Target
+	case "dither", "invert":
+		return true, false
+	case "monochrome", "duotone":
+		// Without a count, as many colors as the palette are generated.
+		return s.Count == 0, false
+	case "map":
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// checkFields returns an error if any field which the step does not accept is
+// set.
+func (s recipeStep) checkFields() error {
+	allowed, ok := recipeStepFields[s.Step]
+	if !ok {
+		return fmt.Errorf("unknown step %q; known steps: %s", s.Step, strings.Join(recipeStepNames, ", "))
+	}
+	v := reflect.ValueOf(s)
+	for idx := 0; idx < v.NumField(); idx++ {
+		name := strings.Split(v.Type().Field(idx).Tag.Get("yaml"), ",")[0]
+		if name != "step" && !v.Field(idx).IsZero() && !contains(allowed, name) {
+			if len(allowed) == 0 {
+				return fmt.Errorf("%q is not used by this step, which has no parameters", name)
+			}
+			return fmt.Errorf("%q is not used by this step; it accepts: %s", name, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// path expands the {name} and {dir} variables in the given path.
+func (st *recipeState) path(path string) string {
+	return strings.NewReplacer("{name}", st.name, "{dir}", st.dir).Replace(path)
+}
+
+// setPalette makes p both the original and the current palette.
+func (st *recipeState) setPalette(p color.Palette) {
+	st.original = append(color.Palette{}, p...)
+	st.palette = append(color.Palette{}, p...)
+}
+
+// remapImage maps every color of the current image through the Map, first
+// mapping colors which are not in it to their nearest source color.
+func (st *recipeState) remapImage(m *palette.Map) error {
+	mapped, err := m.ApplyImage(st.image, palette.FallbackNearestSource)
+	if err != nil {
+		return err
+	}
+	st.image = paletted(mapped, m.Palette())
+	return nil
+}
+
+// compile checks the step's parameters and returns the action which applies
+// it.
+func (s recipeStep) compile() (recipeAction, error) {
+	if err := s.checkFields(); err != nil {
+		return nil, err
+	}
+	switch s.Step {
+	case "extract":
+		alg, err := palette.GetAlgorithm(s.Algorithm)
+		if s.Algorithm == "" {
+			alg, err = palette.GetAlgorithm("kmeans")
+		}
+		if err != nil {
+			return nil, err
+		}
+		algParams := map[string]string{}
+		for k, v := range s.Params {
+			algParams[k] = v
+		}
+		if _, ok := algParams["colors"]; !ok && s.Colors != 0 {
+			algParams["colors"] = fmt.Sprint(s.Colors)
+		}
+		if _, ok := algParams["colorspace"]; !ok && s.Colorspace != "" {
+			algParams["colorspace"] = s.Colorspace
+		}
+		if _, err := alg.ParseArgs(algParams); err != nil {
+			return nil, err
+		}
+		return func(st *recipeState) error {
+			p, err := alg.Run(st.image, algParams)
+			if err != nil {
+				return err
+			}
+			st.setPalette(p)
+			return nil
+		}, nil
+
+	case "load_palette", "load_target":
+		if s.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		return func(st *recipeState) error {
+			p, err := readPalette(st.path(s.Path))
+			if err != nil {
+				return err
+			}
+			if len(p.Colors) == 0 {
+				return fmt.Errorf("palette %q has no colors", st.path(s.Path))
+			}
+			if s.Step == "load_target" {
+				st.target = p.Colors
+			} else {
+				st.setPalette(p.Colors)
+			}
+			return nil
+		}, nil
+
+	case "sort":
+		spec := s.Key
+		if spec == "" {
+			spec = "luminosity"
+		}
+		key, err := palette.ParseSortKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		return func(st *recipeState) error {
+			if s.Target {
+				st.target = palette.SortedBy(st.target, key)
+				return nil
+			}
+			// Sort the original palette in the same order, so that the
+			// two remain aligned.
+			order := make([]int, len(st.palette))
+			for idx := range order {
+				order[idx] = idx
+			}
+			sort.SliceStable(order, func(i, j int) bool {
+				return key(st.palette[order[i]]) < key(st.palette[order[j]])
+			})
+			original, sorted := make(color.Palette, len(order)), make(color.Palette, len(order))
+			for i, idx := range order {
+				original[i], sorted[i] = st.original[idx], st.palette[idx]
+			}
+			st.original, st.palette = original, sorted
+			return nil
+		}, nil
+
+	case "dither":
+		mode := s.Dither
+		if mode == "" {
+			mode = "none"
+		}
+		opts := palette.DitherOptions{Strength: 1, Serpentine: true}
+		if s.Strength != nil {
+			opts.Strength = *s.Strength
+		}
+		if s.Serpentine != nil {
+			opts.Serpentine = *s.Serpentine
+		}
+		if s.ThresholdMap != "" {
+			if mode != "none" && mode != "threshold-map" {
+				return nil, fmt.Errorf("threshold_map cannot be used with dither %q", mode)
+			}
+			m, err := readThresholdMap(s.ThresholdMap)
+			if err != nil {
+				return nil, err
+			}
+			opts.ThresholdMap = &m
+			if mode == "none" {
+				mode = "threshold-map"
+			}
+		}
+		ditherer, err := palette.NewDitherer(mode, opts)
+		if err != nil {
+			return nil, err
+		}
+		return func(st *recipeState) error {
+			if err := palette.CheckPalette(st.palette); err != nil {
+				return err
+			}
+			st.image = ditherer.Dither(st.image, st.palette)
+			return nil
+		}, nil
+
+	case "invert":
+		return func(st *recipeState) error {
+			inverted := palette.InvertPalette(st.palette)
+			m, err := palette.MapDirect(st.palette, inverted)
+			if err != nil {
+				return err
+			}
+			if err := st.remapImage(m); err != nil {
+				return err
+			}
+			st.palette = inverted
+			return nil
+		}, nil
+
+	case "monochrome", "duotone":
+		var from, to color.Color
+		var err error
+		if s.Step == "monochrome" {
+			if s.Color == "" {
+				return nil, fmt.Errorf("color is required")
+			}
+			from, err = palette.HexToColor(s.Color)
+		} else {
+			if s.From == "" || s.To == "" {
+				return nil, fmt.Errorf("from and to are required")
+			}
+			from, err = palette.HexToColor(s.From)
+			if err == nil {
+				to, err = palette.HexToColor(s.To)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.Count < 0 {
+			return nil, fmt.Errorf("steps must not be negative")
+		}
+		return func(st *recipeState) error {
+			// By default, generate as many colors as the palette which
+			// will be mapped onto them.
+			count := s.Count
+			if count == 0 {
+				count = len(st.palette)
+			}
+			if to == nil {
+				st.target = palette.Monochrome(from, count)
+			} else {
+				st.target = palette.Duotone(from, to, count)
+			}
+			return nil
+		}, nil
+
+	case "map":
+		spec := s.Strategy
+		if spec == "" {
+			spec = "luminosity"
+		}
+		strategy, err := palette.ParseMapStrategy(spec)
+		if err != nil {
+			return nil, err
+		}
+		return func(st *recipeState) error {
+			m, err := strategy(st.palette, st.target)
+			if err != nil {
+				return err
+			}
+			newColors := make(color.Palette, 0, len(st.palette))
+			for _, c := range st.palette {
+				newColor, _ := m.Get(c)
+				newColors = append(newColors, newColor)
+			}
+			if s.Soft {
+				st.image, err = palette.Recolor(st.source, st.original, newColors, 0)
+				if err != nil {
+					return err
+				}
+			} else if err := st.remapImage(m); err != nil {
+				return err
+			}
+			st.palette = newColors
+			return nil
+		}, nil
+
+	case "write":
+		if s.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		format := s.Format
+		if format == "" {
+			format = "png"
+		}
+		if _, ok := imageFormats[format]; !ok {
+			return nil, fmt.Errorf("unknown format %q; expected one of: %s", format, strings.Join(imageFormatNames, ", "))
+		}
+		return func(st *recipeState) error {
+			return writeImageFile(st.path(s.Path), format, st.image)
+		}, nil
+
+	case "write_palette":
+		if s.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		return func(st *recipeState) error {
+			colors := st.palette
+			if s.Target {
+				colors = st.target
+			}
+			p := paletteio.New(colors)
+			p.Name = st.name
+			return writePalette(st.path(s.Path), s.Format, p)
+		}, nil
+
+	default:
+		// checkFields has already rejected unknown steps.
+		return nil, fmt.Errorf("unknown step %q", s.Step)
+	}
+}
+
+// runRecipe runs a recipe file over an image.
+func runRecipe(args []string) error {
+	fs := newFlagSet("run", "[flags] <recipe.yaml>", fmt.Sprintf("Run the pipeline described by a YAML or JSON recipe file. Each step changes the current image, palette or target palette, or writes one of them. In paths, {name} is replaced by the name of the input image without its extension, and {dir} by its directory. Steps: %s\n\nExample:\n\n%s", strings.Join(recipeStepNames, ", "), exampleRecipe))
+	input := fs.String("input", "", "Image file to process, or \"-\" to read from stdin, instead of the recipe's input.")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	// Allow flags after the recipe path, too.
+	if fs.NArg() < 1 {
+		return usageError(fs, "a recipe file is required")
+	}
+	recipePath := fs.Arg(0)
+	if err := parseFlags(fs, fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	f, err := os.Open(recipePath)
+	if err != nil {
+		return err
+	}
+	r, err := readRecipe(f)
+	f.Close()
+	if err != nil {
+		return decodeError("recipe", recipePath, err)
+	}
+	actions, err := r.compile()
+	if err != nil {
+		err = fmt.Errorf("invalid recipe %q: %w", recipePath, err)
+		if isIOError(err) {
+			return err
+		}
+		return withExitCode(exitDecode, err)
+	}
+	if *input != "" {
+		r.Input = *input
+	}
+	if r.Input == "" {
+		return usageError(fs, "the recipe has no input, and --input was not given")
+	}
+
+	img, err := readImage(r.Input)
+	if err != nil {
+		return err
+	}
+	st := &recipeState{
+		name:   inputName(r.Input),
+		dir:    filepath.Dir(r.Input),
+		source: img,
+		image:  img,
+	}
+	for idx, action := range actions {
+		if err := action(st); err != nil {
+			return fmt.Errorf("step %d (%s): %w", idx+1, r.Steps[idx].Step, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRecipe(t *testing.T) {
+	r, err := readRecipe(strings.NewReader(exampleRecipe))
+	require.NoError(t, err)
+	require.Equal(t, "photo.jpg", r.Input)
+	require.Len(t, r.Steps, 8)
+	require.Equal(t, "extract", r.Steps[0].Step)
+	require.Equal(t, 6, r.Steps[0].Colors)
+	require.Equal(t, 0.8, *r.Steps[3].Strength)
+	require.Nil(t, r.Steps[3].Serpentine)
+
+	r, err = readRecipe(strings.NewReader(`{"steps": [{"step": "extract", "params": {"colors": "4"}}, {"step": "write", "path": "out.png"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, "", r.Input)
+	require.Len(t, r.Steps, 2)
+	require.Equal(t, map[string]string{"colors": "4"}, r.Steps[0].Params)
+
+	for _, tc := range []struct {
+		name      string
+		recipe    string
+		expectErr string
+	}{
+		{"unknown field", "steps:\n  - step: extract\n    colour: 4", "colour"},
+		{"unknown top-level field", "inputs: a.jpg\nsteps:\n  - step: invert", "inputs"},
+		{"wrong type", "steps:\n  - step: extract\n    colors: many", "many"},
+		{"no steps", "input: a.jpg", "no steps"},
+		{"empty", "", "EOF"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readRecipe(strings.NewReader(tc.recipe))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expectErr)
+		})
+	}
+}
+
+func TestRecipeCompile(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		steps     string
+		expectErr string
+	}{
+		{
+			name:  "palette and target",
+			steps: "[{step: extract, colors: 4}, {step: invert}, {step: monochrome, color: '#336699'}, {step: map, soft: true}, {step: write, path: out.png}]",
+		},
+		{
+			name:  "loaded palettes",
+			steps: "[{step: load_target, path: t.gpl}, {step: sort, target: true}, {step: write_palette, path: t.hex, target: true}, {step: load_palette, path: p.gpl}, {step: map, strategy: direct}]",
+		},
+		{
+			name:  "target without palette",
+			steps: "[{step: duotone, from: '#000000', to: '#ffffff', steps: 4}, {step: write_palette, path: t.gpl, target: true}]",
+		},
+		{
+			name:      "unknown step",
+			steps:     "[{step: blur}]",
+			expectErr: `step 1 (blur): unknown step "blur"`,
+		},
+		{
+			name:      "field of another step",
+			steps:     "[{step: extract, colors: 4, path: p.gpl}]",
+			expectErr: `step 1 (extract): "path" is not used by this step; it accepts: algorithm, params, colors, colorspace`,
+		},
+		{
+			name:      "field of a step without parameters",
+			steps:     "[{step: extract, colors: 4}, {step: invert, soft: true}]",
+			expectErr: `step 2 (invert): "soft" is not used by this step, which has no parameters`,
+		},
+		{
+			name:      "false pointer field",
+			steps:     "[{step: extract, colors: 4}, {step: write, path: out.png, serpentine: false}]",
+			expectErr: `step 2 (write): "serpentine" is not used by this step`,
+		},
+		{
+			name:      "palette used before created",
+			steps:     "[{step: dither, dither: bayer4}]",
+			expectErr: "step 1 (dither): no palette",
+		},
+		{
+			name:      "monochrome sized by missing palette",
+			steps:     "[{step: monochrome, color: '#336699'}]",
+			expectErr: "step 1 (monochrome): no palette",
+		},
+		{
+			name:      "target used before created",
+			steps:     "[{step: extract, colors: 4}, {step: map}]",
+			expectErr: "step 2 (map): no target palette",
+		},
+		{
+			name:      "target sorted before created",
+			steps:     "[{step: extract, colors: 4}, {step: sort, target: true}]",
+			expectErr: "step 2 (sort): no target palette",
+		},
+		{
+			name:      "invalid algorithm params",
+			steps:     "[{step: extract}]",
+			expectErr: "step 1 (extract): ",
+		},
+		{
+			name:      "missing path",
+			steps:     "[{step: load_palette}]",
+			expectErr: "step 1 (load_palette): path is required",
+		},
+		{
+			name:      "invalid color",
+			steps:     "[{step: extract, colors: 4}, {step: duotone, from: '#000000', to: white}]",
+			expectErr: "step 2 (duotone): ",
+		},
+		{
+			name:      "negative steps",
+			steps:     "[{step: monochrome, color: '#336699', steps: -1}]",
+			expectErr: "step 1 (monochrome): steps must not be negative",
+		},
+		{
+			name:      "unknown format",
+			steps:     "[{step: write, path: out.bmp, format: bmp}]",
+			expectErr: `step 1 (write): unknown format "bmp"`,
+		},
+		{
+			name:      "threshold map with another dither",
+			steps:     "[{step: extract, colors: 4}, {step: dither, dither: bayer8, threshold_map: map.png}]",
+			expectErr: `step 2 (dither): threshold_map cannot be used with dither "bayer8"`,
+		},
+		{
+			name:      "unknown dither",
+			steps:     "[{step: extract, colors: 4}, {step: dither, dither: random}]",
+			expectErr: "step 2 (dither): ",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := readRecipe(strings.NewReader("steps: " + tc.steps))
+			require.NoError(t, err)
+			actions, err := r.compile()
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, actions, len(r.Steps))
+		})
+	}
+}
+
+func TestRecipeStepUses(t *testing.T) {
+	for _, tc := range []struct {
+		step          recipeStep
+		expectPalette bool
+		expectTarget  bool
+	}{
+		{recipeStep{Step: "extract"}, false, false},
+		{recipeStep{Step: "load_palette"}, false, false},
+		{recipeStep{Step: "load_target"}, false, false},
+		{recipeStep{Step: "write"}, false, false},
+		{recipeStep{Step: "sort"}, true, false},
+		{recipeStep{Step: "sort", Target: true}, false, true},
+		{recipeStep{Step: "write_palette"}, true, false},
+		{recipeStep{Step: "write_palette", Target: true}, false, true},
+		{recipeStep{Step: "dither"}, true, false},
+		{recipeStep{Step: "invert"}, true, false},
+		{recipeStep{Step: "monochrome"}, true, false},
+		{recipeStep{Step: "duotone", Count: 3}, false, false},
+		{recipeStep{Step: "map"}, true, true},
+	} {
+		usesPalette, usesTarget := tc.step.uses()
+		require.Equal(t, tc.expectPalette, usesPalette, "%+v", tc.step)
+		require.Equal(t, tc.expectTarget, usesTarget, "%+v", tc.step)
+	}
+}
+
+func TestRunRecipe(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			v := uint8(x * 32)
+			img.Set(x, y, color.RGBA{R: v, G: v, B: 255 - v, A: 255})
+		}
+	}
+	input := filepath.Join(dir, "cat.png")
+	f, err := os.Create(input)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+
+	writeRecipe := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+	valid := writeRecipe("valid.yaml", "input: "+input+"\nsteps:\n  - step: extract\n    colors: 3\n  - step: invert\n  - step: write\n    path: '{dir}/{name}_inverted.png'\n  - step: duotone\n    from: '#000000'\n    to: '#ffffff'\n  - step: map\n    soft: true\n  - step: write_palette\n    path: '{dir}/{name}.gpl'\n")
+	noInput := writeRecipe("no_input.yaml", "steps:\n  - step: extract\n    colors: 2\n")
+	undecodable := writeRecipe("undecodable.yaml", "steps: [")
+	invalid := writeRecipe("invalid.yaml", "steps:\n  - step: invert\n")
+	unknownStep := writeRecipe("unknown_step.yaml", "steps:\n  - step: blur\n")
+
+	require.NoError(t, runRecipe([]string{valid}))
+	for _, name := range []string{"cat_inverted.png", "cat.gpl"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+	}
+	// --input overrides the recipe's input, and may follow the recipe path.
+	override := writeRecipe("override.yaml", "input: missing.png\nsteps:\n  - step: extract\n    colors: 2\n  - step: write\n    path: '{dir}/{name}_override.png'\n")
+	require.NoError(t, runRecipe([]string{override, "--input", input}))
+	_, err = os.Stat(filepath.Join(dir, "cat_override.png"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		expect int
+	}{
+		{"no recipe", []string{}, exitUsage},
+		{"extra arguments", []string{valid, "extra"}, exitUsage},
+		{"no input", []string{noInput}, exitUsage},
+		{"missing recipe", []string{filepath.Join(dir, "missing.yaml")}, exitIO},
+		{"undecodable recipe", []string{undecodable}, exitDecode},
+		{"unknown step", []string{unknownStep}, exitDecode},
+		{"invalid recipe", []string{invalid}, exitDecode},
+		{"missing input", []string{valid, "--input", filepath.Join(dir, "missing.png")}, exitIO},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, exitCode(runRecipe(tc.args)))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/palette"
+)
+
+// runRemap remaps the colors of an image from one palette onto another.
+func runRemap(args []string) error {
+	fs := newFlagSet("remap", "--input <image> (--from <palette> --to <palette> | --map <map>) --output <image> [flags]", "Remap the colors of an image onto a new palette. The map between palettes is either built from --from and --to using --map_strategy, or read from --map. Colors of the image which are not in the map are first mapped to their nearest source color.")
+	input := fs.String("input", "", "Image file to remap, or \"-\" to read from stdin. It is usually an image quantized to --from.")
+	from := fs.String("from", "", "Palette file holding the colors of the input image.")
+	to := fs.String("to", "", "Palette file holding the colors onto which the image is remapped.")
+	mapFile := fs.String("map", "", "Palette map to apply instead of --from and --to, as saved by --save_map or a 3D LUT image.")
+	mapStrategy := fs.String("map_strategy", "luminosity", fmt.Sprintf("Strategy used to map --from onto --to. One of: %s", strings.Join(palette.MapStrategyNames, ", ")))
+	softRecolor := fs.Bool("soft_recolor", false, "Recolor the image by blending the palette changes from --from to --to, rather than replacing each pixel with a single palette color.")
+	saveMap := fs.String("save_map", "", "File to which the palette map is saved, as JSON (.json) or a LUT image (.png).")
+	lutSize := fs.Int("lut_size", 0, "Save --save_map images as 3D LUTs which sample the RGB cube at this many points along each axis, rather than as 1D LUTs.")
+	output := fs.String("output", "", "Image file to write, or \"-\" to write to stdout.")
+	format := fs.String("format", "png", fmt.Sprintf("Format of the image written, unless given by the extension of --output. One of: %s", strings.Join(imageFormatNames, ", ")))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *input == "" || *output == "" {
+		return usageError(fs, "--input and --output are required")
+	}
+	if *mapFile != "" && (*from != "" || *to != "") {
+		return usageError(fs, "--map cannot be used with --from or --to")
+	}
+	if *mapFile == "" && (*from == "" || *to == "") {
+		return usageError(fs, "either --from and --to, or --map, is required")
+	}
+	if *softRecolor && *mapFile != "" {
+		return usageError(fs, "--soft_recolor requires --from and --to")
+	}
+	if _, ok := imageFormats[*format]; !ok {
+		return usageError(fs, "unknown --format %q; expected one of: %s", *format, strings.Join(imageFormatNames, ", "))
+	}
+	if *saveMap != "" {
+		if err := checkMapPath(*saveMap, *lutSize); err != nil {
+			return err
+		}
+	} else if *lutSize != 0 {
+		return usageError(fs, "--lut_size requires --save_map")
+	}
+
+	var mapping *palette.Map
+	var fromColors color.Palette
+	if *mapFile != "" {
+		m, err := readMap(*mapFile)
+		if err != nil {
+			return err
+		}
+		mapping = m
+	} else {
+		strategy, err := palette.ParseMapStrategy(*mapStrategy)
+		if err != nil {
+			return invalidUsage(err)
+		}
+		fromPalette, err := readPalette(*from)
+		if err != nil {
+			return err
+		}
+		toPalette, err := readPalette(*to)
+		if err != nil {
+			return err
+		}
+		fromColors = fromPalette.Colors
+		mapping, err = strategy(fromColors, toPalette.Colors)
+		if err != nil {
+			return err
+		}
+	}
+	if *saveMap != "" {
+		if err := writeMap(*saveMap, mapping, *lutSize); err != nil {
+			return err
+		}
+	}
+
+	img, err := readImage(*input)
+	if err != nil {
+		return err
+	}
+	var dst image.Image
+	if *softRecolor {
+		newColors := make(color.Palette, 0, len(fromColors))
+		for _, c := range fromColors {
+			newColor, _ := mapping.Get(c)
+			newColors = append(newColors, newColor)
+		}
+		dst, err = palette.Recolor(img, fromColors, newColors, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		mapped, err := mapping.ApplyImage(img, palette.FallbackNearestSource)
+		if err != nil {
+			return err
+		}
+		dst = paletted(mapped, mapping.Palette())
+	}
+	return writeImageFile(*output, *format, dst)
+}
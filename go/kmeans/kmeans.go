@@ -8,6 +8,12 @@ import (
 // KMeans implements a naive k-means algorithm. Note: all of the Points in the
 // provided data must have the same dimensionality.
 func KMeans(data []Point, k, maxIterations int) ([]Point, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("k must be at least 1, got %d", k)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("provided data is empty")
+	}
 	dimensions := -1
 	for _, point := range data {
 		if dimensions == -1 {
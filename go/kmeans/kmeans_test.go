@@ -52,3 +52,12 @@ func TestKMeans(t *testing.T) {
 		{10, 10, 10},
 	})
 }
+
+func TestKMeansInvalid(t *testing.T) {
+	_, err := KMeans(nil, 1, 100)
+	require.EqualError(t, err, "provided data is empty")
+	_, err = KMeans([]Point{{0, 0, 0}}, 0, 100)
+	require.EqualError(t, err, "k must be at least 1, got 0")
+	_, err = KMeans([]Point{{0, 0, 0}, {0, 0}}, 1, 100)
+	require.Error(t, err)
+}
@@ -0,0 +1,253 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamType describes the type of value accepted by a Param.
+type ParamType int
+
+const (
+	// ParamInt indicates an integer parameter.
+	ParamInt ParamType = iota
+	// ParamColor indicates a color parameter, given as a hex string of the
+	// form "#ffffff".
+	ParamColor
+	// ParamColorSpace indicates a ColorSpace parameter, given by name.
+	ParamColorSpace
+)
+
+// String implements fmt.Stringer.
+func (t ParamType) String() string {
+	switch t {
+	case ParamInt:
+		return "int"
+	case ParamColor:
+		return "color"
+	case ParamColorSpace:
+		return "colorspace"
+	default:
+		return fmt.Sprintf("ParamType(%d)", int(t))
+	}
+}
+
+// Param describes a single parameter accepted by an Algorithm.
+type Param struct {
+	Name        string
+	Description string
+	Type        ParamType
+	// Default is the string form of the default value. If empty, the
+	// parameter is required.
+	Default string
+	// Min is the smallest value accepted by an integer parameter. If zero,
+	// any value is accepted.
+	Min int
+}
+
+// Args holds the parsed parameter values for an Algorithm, keyed by Param
+// name.
+type Args map[string]interface{}
+
+// Int returns the value of the given integer parameter.
+func (a Args) Int(name string) int {
+	v, _ := a[name].(int)
+	return v
+}
+
+// Color returns the value of the given color parameter.
+func (a Args) Color(name string) color.Color {
+	v, ok := a[name].(color.Color)
+	if !ok {
+		return color.Black
+	}
+	return v
+}
+
+// ColorSpace returns the value of the given ColorSpace parameter.
+func (a Args) ColorSpace(name string) ColorSpace {
+	v, _ := a[name].(ColorSpace)
+	return v
+}
+
+// Algorithm describes a named method of producing a color.Palette.
+type Algorithm struct {
+	Name        string
+	Description string
+	Params      []Param
+	// New creates a color.Palette. The image may be ignored by algorithms
+	// which do not derive their palette from an image.
+	New func(img image.Image, args Args) (color.Palette, error)
+}
+
+// ParseArgs parses the given raw string values into Args, filling in defaults
+// for any parameters which were not provided.
+func (a Algorithm) ParseArgs(raw map[string]string) (Args, error) {
+	known := make(map[string]bool, len(a.Params))
+	args := make(Args, len(a.Params))
+	for _, param := range a.Params {
+		known[param.Name] = true
+		str, ok := raw[param.Name]
+		if !ok {
+			if param.Default == "" {
+				return nil, fmt.Errorf("algorithm %q requires parameter %q", a.Name, param.Name)
+			}
+			str = param.Default
+		}
+		switch param.Type {
+		case ParamInt:
+			v, err := strconv.Atoi(str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s parameter %q: %s", str, param.Type, param.Name, err)
+			}
+			if param.Min != 0 && v < param.Min {
+				return nil, fmt.Errorf("invalid value %q for %s parameter %q: must be at least %d", str, param.Type, param.Name, param.Min)
+			}
+			args[param.Name] = v
+		case ParamColor:
+			v, err := HexToColor(str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s parameter %q: %s", str, param.Type, param.Name, err)
+			}
+			args[param.Name] = v
+		case ParamColorSpace:
+			v, err := ParseColorSpace(str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s parameter %q: %s", str, param.Type, param.Name, err)
+			}
+			args[param.Name] = v
+		default:
+			return nil, fmt.Errorf("parameter %q has unknown type %s", param.Name, param.Type)
+		}
+	}
+	for name := range raw {
+		if !known[name] {
+			return nil, fmt.Errorf("algorithm %q has no parameter %q", a.Name, name)
+		}
+	}
+	return args, nil
+}
+
+// HasParam returns true if the Algorithm accepts a parameter with the given
+// name.
+func (a Algorithm) HasParam(name string) bool {
+	for _, param := range a.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Run parses the given raw parameter values and runs the Algorithm.
+func (a Algorithm) Run(img image.Image, raw map[string]string) (color.Palette, error) {
+	args, err := a.ParseArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+	return a.New(img, args)
+}
+
+var algorithms = map[string]Algorithm{}
+
+// RegisterAlgorithm makes the given Algorithm available by name. It panics if
+// an Algorithm with the same name is already registered.
+func RegisterAlgorithm(alg Algorithm) {
+	if _, ok := algorithms[alg.Name]; ok {
+		panic(fmt.Sprintf("algorithm %q is already registered", alg.Name))
+	}
+	algorithms[alg.Name] = alg
+}
+
+// GetAlgorithm returns the registered Algorithm with the given name.
+func GetAlgorithm(name string) (Algorithm, error) {
+	alg, ok := algorithms[name]
+	if !ok {
+		return Algorithm{}, fmt.Errorf("unknown algorithm %q; known algorithms: %s", name, strings.Join(AlgorithmNames(), ", "))
+	}
+	return alg, nil
+}
+
+// Algorithms returns all registered Algorithms, sorted by name.
+func Algorithms() []Algorithm {
+	rv := make([]Algorithm, 0, len(algorithms))
+	for _, alg := range algorithms {
+		rv = append(rv, alg)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+// AlgorithmNames returns the names of all registered Algorithms, sorted.
+func AlgorithmNames() []string {
+	rv := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// ParseParams parses a comma-separated list of key=value pairs, eg.
+// "colors=8,iterations=100".
+func ParseParams(str string) (map[string]string, error) {
+	rv := map[string]string{}
+	if str == "" {
+		return rv, nil
+	}
+	for _, pair := range strings.Split(str, ",") {
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) != 2 || split[0] == "" {
+			return nil, fmt.Errorf("invalid parameter %q; expected key=value", pair)
+		}
+		rv[strings.TrimSpace(split[0])] = strings.TrimSpace(split[1])
+	}
+	return rv, nil
+}
+
+const defaultMaxKMeansIterations = "1000"
+
+func init() {
+	RegisterAlgorithm(Algorithm{
+		Name:        "kmeans",
+		Description: "Cluster the pixels of the image using k-means.",
+		Params: []Param{
+			{Name: "colors", Description: "Number of colors in the palette.", Type: ParamInt, Min: 1},
+			{Name: "iterations", Description: "Maximum number of k-means iterations.", Type: ParamInt, Default: defaultMaxKMeansIterations, Min: 1},
+			{Name: "colorspace", Description: "Color space in which to cluster the pixels.", Type: ParamColorSpace, Default: RGB.String()},
+		},
+		New: func(img image.Image, args Args) (color.Palette, error) {
+			if img == nil {
+				return nil, fmt.Errorf("kmeans requires an image")
+			}
+			return FromImage(img, args.Int("colors"), args.Int("iterations"), args.ColorSpace("colorspace"))
+		},
+	})
+	RegisterAlgorithm(Algorithm{
+		Name:        "subdivide",
+		Description: "Subdivide the RGB color space evenly, ignoring the image.",
+		Params: []Param{
+			{Name: "divisions", Description: "Number of divisions per channel; the palette has divisions^3 colors.", Type: ParamInt, Min: 1},
+		},
+		New: func(_ image.Image, args Args) (color.Palette, error) {
+			return Subdivide(args.Int("divisions")), nil
+		},
+	})
+	RegisterAlgorithm(Algorithm{
+		Name:        "monochrome",
+		Description: "Interpolate between black, the given color and white, ignoring the image.",
+		Params: []Param{
+			{Name: "color", Description: "Base color of the palette.", Type: ParamColor},
+			{Name: "colors", Description: "Number of colors in the palette.", Type: ParamInt, Min: 1},
+		},
+		New: func(_ image.Image, args Args) (color.Palette, error) {
+			return Monochrome(args.Color("color"), args.Int("colors")), nil
+		},
+	})
+}
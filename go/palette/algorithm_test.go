@@ -0,0 +1,88 @@
+package palette
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseParams(t *testing.T) {
+	actual, err := ParseParams("colors=8, iterations=100")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"colors": "8", "iterations": "100"}, actual)
+
+	actual, err = ParseParams("")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{}, actual)
+
+	_, err = ParseParams("colors")
+	require.Error(t, err)
+}
+
+func TestAlgorithmParseArgs(t *testing.T) {
+	alg, err := GetAlgorithm("monochrome")
+	require.NoError(t, err)
+
+	args, err := alg.ParseArgs(map[string]string{"color": "#102030", "colors": "4"})
+	require.NoError(t, err)
+	require.Equal(t, 4, args.Int("colors"))
+	require.Equal(t, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 255}, args.Color("color"))
+
+	_, err = alg.ParseArgs(map[string]string{"color": "#102030"})
+	require.EqualError(t, err, `algorithm "monochrome" requires parameter "colors"`)
+	_, err = alg.ParseArgs(map[string]string{"color": "#102030", "colors": "4", "bogus": "1"})
+	require.EqualError(t, err, `algorithm "monochrome" has no parameter "bogus"`)
+	_, err = alg.ParseArgs(map[string]string{"color": "#102030", "colors": "four"})
+	require.Error(t, err)
+
+	alg, err = GetAlgorithm("kmeans")
+	require.NoError(t, err)
+	args, err = alg.ParseArgs(map[string]string{"colors": "4"})
+	require.NoError(t, err)
+	require.Equal(t, 1000, args.Int("iterations"))
+
+	_, err = GetAlgorithm("bogus")
+	require.Error(t, err)
+}
+
+func TestAlgorithmParseArgsMin(t *testing.T) {
+	for _, tc := range []struct {
+		alg    string
+		raw    map[string]string
+		expect string
+	}{
+		{"kmeans", map[string]string{"colors": "0"}, `invalid value "0" for int parameter "colors": must be at least 1`},
+		{"kmeans", map[string]string{"colors": "-1"}, `invalid value "-1" for int parameter "colors": must be at least 1`},
+		{"kmeans", map[string]string{"colors": "4", "iterations": "0"}, `invalid value "0" for int parameter "iterations": must be at least 1`},
+		{"kmeans", map[string]string{"colors": "4", "iterations": "-1"}, `invalid value "-1" for int parameter "iterations": must be at least 1`},
+		{"subdivide", map[string]string{"divisions": "0"}, `invalid value "0" for int parameter "divisions": must be at least 1`},
+		{"subdivide", map[string]string{"divisions": "-3"}, `invalid value "-3" for int parameter "divisions": must be at least 1`},
+		{"monochrome", map[string]string{"color": "#ff0000", "colors": "0"}, `invalid value "0" for int parameter "colors": must be at least 1`},
+		{"monochrome", map[string]string{"color": "#ff0000", "colors": "-1"}, `invalid value "-1" for int parameter "colors": must be at least 1`},
+	} {
+		alg, err := GetAlgorithm(tc.alg)
+		require.NoError(t, err)
+		_, err = alg.ParseArgs(tc.raw)
+		require.EqualError(t, err, tc.expect, "%s %v", tc.alg, tc.raw)
+	}
+
+	for name, raw := range map[string]map[string]string{
+		"kmeans":     {"colors": "1", "iterations": "1"},
+		"subdivide":  {"divisions": "1"},
+		"monochrome": {"color": "#ff0000", "colors": "1"},
+	} {
+		alg, err := GetAlgorithm(name)
+		require.NoError(t, err)
+		_, err = alg.ParseArgs(raw)
+		require.NoError(t, err, name)
+	}
+}
+
+func TestAlgorithmRun(t *testing.T) {
+	alg, err := GetAlgorithm("subdivide")
+	require.NoError(t, err)
+	p, err := alg.Run(nil, map[string]string{"divisions": "2"})
+	require.NoError(t, err)
+	require.Len(t, p, 8)
+}
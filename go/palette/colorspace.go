@@ -0,0 +1,109 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+	"github.com/erock2112/kmeans/go/kmeans"
+)
+
+// ColorSpace describes a working color space in which colors are compared
+// and clustered.
+type ColorSpace int
+
+const (
+	// RGB uses raw 16-bit sRGB channel values.
+	RGB ColorSpace = iota
+	// OKLab uses the perceptually uniform OKLab space.
+	OKLab
+	// CIELAB uses the CIE L*a*b* space with a D65 white point.
+	CIELAB
+)
+
+// ColorSpaces lists all of the supported ColorSpaces.
+var ColorSpaces = []ColorSpace{RGB, OKLab, CIELAB}
+
+// Scale factors used to convert floating point color space coordinates to the
+// integers used by kmeans.Point. These are chosen so that one unit in each
+// space spans roughly the same number of integer steps as the full 16-bit
+// range of an RGB channel.
+const (
+	oklabScale  = 1 << 16
+	cielabScale = 1 << 9
+)
+
+// String implements fmt.Stringer.
+func (s ColorSpace) String() string {
+	switch s {
+	case RGB:
+		return "rgb"
+	case OKLab:
+		return "oklab"
+	case CIELAB:
+		return "cielab"
+	default:
+		return fmt.Sprintf("ColorSpace(%d)", int(s))
+	}
+}
+
+// ParseColorSpace returns the ColorSpace with the given name.
+func ParseColorSpace(name string) (ColorSpace, error) {
+	names := make([]string, 0, len(ColorSpaces))
+	for _, s := range ColorSpaces {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+		names = append(names, s.String())
+	}
+	return RGB, fmt.Errorf("unknown color space %q; known color spaces: %s", name, strings.Join(names, ", "))
+}
+
+// ToPoint converts the color.Color to a kmeans.Point in this ColorSpace.
+func (s ColorSpace) ToPoint(c color.Color) kmeans.Point {
+	switch s {
+	case OKLab:
+		lab := colorspace.ToOKLab(c)
+		return kmeans.Point{scaled(lab.L, oklabScale), scaled(lab.A, oklabScale), scaled(lab.B, oklabScale)}
+	case CIELAB:
+		lab := colorspace.ToLab(c)
+		return kmeans.Point{scaled(lab.L, cielabScale), scaled(lab.A, cielabScale), scaled(lab.B, cielabScale)}
+	default:
+		return ColorToPoint(c)
+	}
+}
+
+// FromPoint converts a kmeans.Point in this ColorSpace back to a color.Color.
+func (s ColorSpace) FromPoint(p kmeans.Point) color.Color {
+	switch s {
+	case OKLab:
+		return colorspace.OKLab{
+			L: float64(p[0]) / oklabScale,
+			A: float64(p[1]) / oklabScale,
+			B: float64(p[2]) / oklabScale,
+		}
+	case CIELAB:
+		return colorspace.Lab{
+			L: float64(p[0]) / cielabScale,
+			A: float64(p[1]) / cielabScale,
+			B: float64(p[2]) / cielabScale,
+		}
+	default:
+		return color.RGBA64{R: clamp16(p[0]), G: clamp16(p[1]), B: clamp16(p[2]), A: math.MaxUint16}
+	}
+}
+
+func scaled(v float64, scale float64) int {
+	return int(math.Round(v * scale))
+}
+
+func clamp16(v int) uint16 {
+	if v < 0 {
+		return 0
+	} else if v > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(v)
+}
@@ -0,0 +1,49 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColorSpace(t *testing.T) {
+	for _, s := range ColorSpaces {
+		actual, err := ParseColorSpace(s.String())
+		require.NoError(t, err)
+		require.Equal(t, s, actual)
+	}
+	actual, err := ParseColorSpace("OKLab")
+	require.NoError(t, err)
+	require.Equal(t, OKLab, actual)
+	_, err = ParseColorSpace("bogus")
+	require.Error(t, err)
+}
+
+func TestFromImageColorSpace(t *testing.T) {
+	colors := []color.RGBA{
+		{R: 10, G: 20, B: 30, A: 255},
+		{R: 240, G: 200, B: 100, A: 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			img.Set(x, y, colors[(x+y)%2])
+		}
+	}
+	for _, space := range ColorSpaces {
+		t.Run(space.String(), func(t *testing.T) {
+			p, err := FromImage(img, 2, 100, space)
+			require.NoError(t, err)
+			actual := SortedByLuminosity(p)
+			require.Len(t, actual, 2)
+			for idx, expect := range colors {
+				got := actual[idx].(color.RGBA)
+				require.InDelta(t, expect.R, got.R, 1)
+				require.InDelta(t, expect.G, got.G, 1)
+				require.InDelta(t, expect.B, got.B, 1)
+			}
+		})
+	}
+}
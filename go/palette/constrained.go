@@ -0,0 +1,265 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// MapConstraints restricts the Maps produced by MapConstrained. The zero value
+// imposes no constraints, so that every source color maps to its nearest
+// destination color.
+type MapConstraints struct {
+	// PreserveLuminosityOrder requires that if one source color is brighter
+	// than another, it maps to a destination color which is at least as
+	// bright as that of the other.
+	PreserveLuminosityOrder bool
+	// MaxPerDestination limits the number of source colors which may map to
+	// any single destination color. Zero means no limit.
+	MaxPerDestination int
+	// UseAllDestinations requires that every destination color is mapped to
+	// by at least one source color.
+	UseAllDestinations bool
+}
+
+// MapConstrained creates a Map from src to dst which may map several source
+// colors onto a single destination color, subject to the given constraints.
+// The result has the least total error, as measured by the given Distance, of
+// all Maps which satisfy the constraints. Luminosity order is solved exactly
+// using dynamic programming; the other constraints are solved exactly as a
+// minimum-cost flow problem.
+func MapConstrained(src, dst color.Palette, constraints MapConstraints, distance Distance) (*Map, error) {
+	if len(src) == 0 {
+		return NewMapWithPalette(dst), nil
+	}
+	if len(dst) == 0 {
+		return nil, fmt.Errorf("dst palette is empty")
+	}
+	if constraints.MaxPerDestination < 0 {
+		return nil, fmt.Errorf("invalid MaxPerDestination %d", constraints.MaxPerDestination)
+	}
+	if constraints.MaxPerDestination > 0 && len(src) > len(dst)*constraints.MaxPerDestination {
+		return nil, fmt.Errorf("cannot map %d colors onto %d colors with at most %d per destination", len(src), len(dst), constraints.MaxPerDestination)
+	}
+	if constraints.UseAllDestinations && len(src) < len(dst) {
+		return nil, fmt.Errorf("cannot use all %d dst colors with only %d src colors", len(dst), len(src))
+	}
+	if constraints.PreserveLuminosityOrder {
+		return mapLuminosityOrdered(src, dst, constraints, distance)
+	}
+	return mapMinCostFlow(src, dst, constraints, distance)
+}
+
+// indexesByLuminosity returns the indexes of the palette entries, sorted by
+// luminosity.
+func indexesByLuminosity(p color.Palette) []int {
+	rv := make([]int, len(p))
+	for idx := range rv {
+		rv[idx] = idx
+	}
+	sort.SliceStable(rv, func(i, j int) bool {
+		return Luminosity(p[rv[i]]) < Luminosity(p[rv[j]])
+	})
+	return rv
+}
+
+// mapLuminosityOrdered solves MapConstrained with PreserveLuminosityOrder.
+// With both palettes sorted by luminosity, a valid Map assigns consecutive
+// runs of source colors to an increasing sequence of destination colors.
+func mapLuminosityOrdered(src, dst color.Palette, constraints MapConstraints, distance Distance) (*Map, error) {
+	srcOrder := indexesByLuminosity(src)
+	dstOrder := indexesByLuminosity(dst)
+	n, m := len(src), len(dst)
+	maxRun := n
+	if constraints.MaxPerDestination > 0 && constraints.MaxPerDestination < n {
+		maxRun = constraints.MaxPerDestination
+	}
+
+	// runCost[j][i] is the total cost of mapping the first i sorted source
+	// colors onto sorted destination j, so that the cost of a run is the
+	// difference of two entries.
+	runCost := make([][]float64, m)
+	for j := range runCost {
+		runCost[j] = make([]float64, n+1)
+		for i := 0; i < n; i++ {
+			runCost[j][i+1] = runCost[j][i] + distance(src[srcOrder[i]], dst[dstOrder[j]])
+		}
+	}
+
+	// best[i][j] is the least cost of mapping the first i sorted source
+	// colors such that the last run maps onto sorted destination j. prev
+	// records the start of that run, and prevDst the destination of the run
+	// before it. bestBefore[i][j] and bestBeforeDst[i][j] give the least value of
+	// best[i][k] for any k < j, and the k which achieves it.
+	inf := math.Inf(1)
+	best := make([][]float64, n+1)
+	prev := make([][]int, n+1)
+	prevDst := make([][]int, n+1)
+	bestBefore := make([][]float64, n+1)
+	bestBeforeDst := make([][]int, n+1)
+	for i := range best {
+		best[i] = make([]float64, m)
+		prev[i] = make([]int, m)
+		prevDst[i] = make([]int, m)
+		bestBefore[i] = make([]float64, m)
+		bestBeforeDst[i] = make([]int, m)
+		for j := range best[i] {
+			best[i][j] = inf
+		}
+	}
+	for i := 1; i <= n; i++ {
+		for j := 0; j < m; j++ {
+			for run := 1; run <= maxRun && run <= i; run++ {
+				start := i - run
+				cost := runCost[j][i] - runCost[j][start]
+				before, beforeDst := 0.0, -1
+				if start > 0 {
+					before = inf
+					if constraints.UseAllDestinations {
+						if j > 0 {
+							before, beforeDst = best[start][j-1], j-1
+						}
+					} else {
+						before, beforeDst = bestBefore[start][j], bestBeforeDst[start][j]
+					}
+				} else if constraints.UseAllDestinations && j != 0 {
+					// The first run must use the first destination.
+					continue
+				}
+				if before+cost < best[i][j] {
+					best[i][j] = before + cost
+					prev[i][j] = start
+					prevDst[i][j] = beforeDst
+				}
+			}
+		}
+		bestBefore[i][0], bestBeforeDst[i][0] = inf, -1
+		for j := 1; j < m; j++ {
+			bestBefore[i][j], bestBeforeDst[i][j] = bestBefore[i][j-1], bestBeforeDst[i][j-1]
+			if best[i][j-1] < bestBefore[i][j] {
+				bestBefore[i][j], bestBeforeDst[i][j] = best[i][j-1], j-1
+			}
+		}
+	}
+
+	lastDst := -1
+	if constraints.UseAllDestinations {
+		lastDst = m - 1
+	} else {
+		for j := 0; j < m; j++ {
+			if lastDst < 0 || best[n][j] < best[n][lastDst] {
+				lastDst = j
+			}
+		}
+	}
+	if math.IsInf(best[n][lastDst], 1) {
+		return nil, fmt.Errorf("no mapping satisfies the constraints")
+	}
+	assignment := make([]int, n)
+	for i, j := n, lastDst; i > 0; {
+		start, before := prev[i][j], prevDst[i][j]
+		for k := start; k < i; k++ {
+			assignment[srcOrder[k]] = dstOrder[j]
+		}
+		i, j = start, before
+	}
+	return mapFromAssignment(src, dst, assignment), nil
+}
+
+// flowEdge is an edge in the residual graph used by mapMinCostFlow.
+type flowEdge struct {
+	to, rev  int
+	capacity int
+	cost     float64
+}
+
+// mapMinCostFlow solves MapConstrained without luminosity ordering, as a
+// minimum-cost flow from a source node through one node per src color and one
+// node per dst color to a sink node.
+func mapMinCostFlow(src, dst color.Palette, constraints MapConstraints, distance Distance) (*Map, error) {
+	n, m := len(src), len(dst)
+	source, sink := n+m, n+m+1
+	graph := make([][]flowEdge, n+m+2)
+	addEdge := func(from, to, capacity int, cost float64) {
+		graph[from] = append(graph[from], flowEdge{to: to, rev: len(graph[to]), capacity: capacity, cost: cost})
+		graph[to] = append(graph[to], flowEdge{to: from, rev: len(graph[from]) - 1, capacity: 0, cost: -cost})
+	}
+
+	maxCost := 0.0
+	for i := 0; i < n; i++ {
+		addEdge(source, i, 1, 0)
+		for j := 0; j < m; j++ {
+			cost := distance(src[i], dst[j])
+			maxCost = math.Max(maxCost, cost)
+			addEdge(i, n+j, 1, cost)
+		}
+	}
+	capacity := n
+	if constraints.MaxPerDestination > 0 {
+		capacity = constraints.MaxPerDestination
+	}
+	// Enforce UseAllDestinations with a bonus which outweighs the total cost
+	// of any mapping, so that each destination's first unit of flow is always
+	// preferred.
+	bonus := maxCost*float64(n) + 1
+	for j := 0; j < m; j++ {
+		if constraints.UseAllDestinations {
+			addEdge(n+j, sink, 1, -bonus)
+			if capacity > 1 {
+				addEdge(n+j, sink, capacity-1, 0)
+			}
+		} else {
+			addEdge(n+j, sink, capacity, 0)
+		}
+	}
+
+	// Successive shortest paths. The graph has negative edge costs, so use
+	// Bellman-Ford (SPFA) rather than Dijkstra.
+	dist := make([]float64, len(graph))
+	inQueue := make([]bool, len(graph))
+	prevNode := make([]int, len(graph))
+	prevEdge := make([]int, len(graph))
+	for flow := 0; flow < n; flow++ {
+		for i := range dist {
+			dist[i] = math.Inf(1)
+		}
+		dist[source] = 0
+		queue := []int{source}
+		inQueue[source] = true
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			inQueue[node] = false
+			for idx, e := range graph[node] {
+				if e.capacity > 0 && dist[node]+e.cost < dist[e.to] {
+					dist[e.to] = dist[node] + e.cost
+					prevNode[e.to] = node
+					prevEdge[e.to] = idx
+					if !inQueue[e.to] {
+						queue = append(queue, e.to)
+						inQueue[e.to] = true
+					}
+				}
+			}
+		}
+		if math.IsInf(dist[sink], 1) {
+			return nil, fmt.Errorf("no mapping satisfies the constraints")
+		}
+		for node := sink; node != source; node = prevNode[node] {
+			e := &graph[prevNode[node]][prevEdge[node]]
+			e.capacity--
+			graph[node][e.rev].capacity++
+		}
+	}
+
+	assignment := make([]int, n)
+	for i := 0; i < n; i++ {
+		for _, e := range graph[i] {
+			if e.to >= n && e.to < n+m && e.capacity == 0 {
+				assignment[i] = e.to - n
+			}
+		}
+	}
+	return mapFromAssignment(src, dst, assignment), nil
+}
@@ -0,0 +1,103 @@
+package palette
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bruteForceConstrained returns the least total error of any Map from src to
+// dst which satisfies the constraints, by trying every possible assignment.
+func bruteForceConstrained(src, dst color.Palette, constraints MapConstraints, distance Distance) float64 {
+	best := math.Inf(1)
+	assignment := make([]int, len(src))
+	var helper func(i int)
+	helper = func(i int) {
+		if i < len(src) {
+			for j := range dst {
+				assignment[i] = j
+				helper(i + 1)
+			}
+			return
+		}
+		counts := make([]int, len(dst))
+		total := 0.0
+		for a, b := range assignment {
+			counts[b]++
+			total += distance(src[a], dst[b])
+			if constraints.PreserveLuminosityOrder {
+				for c, d := range assignment {
+					if Luminosity(src[a]) < Luminosity(src[c]) && Luminosity(dst[b]) > Luminosity(dst[d]) {
+						return
+					}
+				}
+			}
+		}
+		for _, count := range counts {
+			if constraints.MaxPerDestination > 0 && count > constraints.MaxPerDestination {
+				return
+			}
+			if constraints.UseAllDestinations && count == 0 {
+				return
+			}
+		}
+		best = math.Min(best, total)
+	}
+	helper(0)
+	return best
+}
+
+// distinctLuminosityPalette returns a random palette whose colors all have
+// distinct luminosities, so that luminosity order is unambiguous.
+func distinctLuminosityPalette(r *rand.Rand, n int) color.Palette {
+	for {
+		p := randomPalette(r, n)
+		seen := map[uint8]bool{}
+		for _, c := range p {
+			seen[Luminosity(c)] = true
+		}
+		if len(seen) == n {
+			return p
+		}
+	}
+}
+
+func TestMapConstrained(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for trial := 0; trial < 100; trial++ {
+		src := distinctLuminosityPalette(r, 1+r.Intn(6))
+		dst := distinctLuminosityPalette(r, 1+r.Intn(4))
+		constraints := MapConstraints{
+			PreserveLuminosityOrder: r.Intn(2) == 0,
+			MaxPerDestination:       r.Intn(4),
+			UseAllDestinations:      r.Intn(2) == 0,
+		}
+		expect := bruteForceConstrained(src, dst, constraints, DistanceRGB)
+		actual, err := MapConstrained(src, dst, constraints, DistanceRGB)
+		if math.IsInf(expect, 1) {
+			require.Error(t, err, "%+v: %v -> %v", constraints, src, dst)
+			continue
+		}
+		require.NoError(t, err, "%+v: %v -> %v", constraints, src, dst)
+		require.Equal(t, len(src), actual.Len())
+		require.InDelta(t, expect, actual.ComputeErrorDistance(DistanceRGB), 1e-6, "%+v: %v -> %v", constraints, src, dst)
+	}
+}
+
+func TestMapConstrainedManyToOne(t *testing.T) {
+	src := Subdivide(2)
+	dst := color.Palette{color.Black, color.White}
+	m, err := MapConstrained(src, dst, MapConstraints{}, DistanceRGB)
+	require.NoError(t, err)
+	require.Equal(t, 8, m.Len())
+	requireMapsTo(t, m, src[0], dst[0])
+	requireMapsTo(t, m, src[7], dst[1])
+
+	_, err = MapConstrained(src, dst, MapConstraints{MaxPerDestination: 3}, DistanceRGB)
+	require.Error(t, err)
+	_, err = MapConstrained(dst, src, MapConstraints{UseAllDestinations: true}, DistanceRGB)
+	require.Error(t, err)
+}
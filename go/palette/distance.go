@@ -0,0 +1,68 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+)
+
+// Distance returns a measure of the difference between two colors. Smaller
+// values indicate more similar colors.
+type Distance func(a, b color.Color) float64
+
+// Distance functions which may be used for palette mapping and for error
+// reporting.
+var (
+	// DistanceRGB is the squared Euclidean distance between 16-bit RGB
+	// values. This is the distance used by Map.ComputeError.
+	DistanceRGB Distance = func(a, b color.Color) float64 {
+		return float64(ColorToPoint(a).SqDist(ColorToPoint(b)))
+	}
+	// DistanceCIE76 is the CIE76 ΔE.
+	DistanceCIE76 Distance = func(a, b color.Color) float64 {
+		return colorspace.DeltaE76(colorspace.ToLab(a), colorspace.ToLab(b))
+	}
+	// DistanceCIE94 is the CIE94 ΔE, using the graphic arts constants.
+	DistanceCIE94 Distance = func(a, b color.Color) float64 {
+		return colorspace.DeltaE94(colorspace.ToLab(a), colorspace.ToLab(b))
+	}
+	// DistanceCIEDE2000 is the CIEDE2000 ΔE.
+	DistanceCIEDE2000 Distance = func(a, b color.Color) float64 {
+		return colorspace.DeltaE2000(colorspace.ToLab(a), colorspace.ToLab(b))
+	}
+	// DistanceOKLab is the Euclidean distance in OKLab.
+	DistanceOKLab Distance = func(a, b color.Color) float64 {
+		return colorspace.DeltaEOK(colorspace.ToOKLab(a), colorspace.ToOKLab(b))
+	}
+)
+
+var distances = map[string]Distance{
+	"rgb":       DistanceRGB,
+	"cie76":     DistanceCIE76,
+	"cie94":     DistanceCIE94,
+	"ciede2000": DistanceCIEDE2000,
+	"oklab":     DistanceOKLab,
+}
+
+// DistanceNames returns the names of the supported Distance functions,
+// sorted.
+func DistanceNames() []string {
+	rv := make([]string, 0, len(distances))
+	for name := range distances {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// ParseDistance returns the Distance function with the given name.
+func ParseDistance(name string) (Distance, error) {
+	d, ok := distances[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown distance %q; known distances: %s", name, strings.Join(DistanceNames(), ", "))
+	}
+	return d, nil
+}
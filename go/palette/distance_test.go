@@ -0,0 +1,50 @@
+package palette
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapNearestDistance(t *testing.T) {
+	red := color.RGBA{R: 200, G: 10, B: 10, A: 255}
+	green := color.RGBA{R: 10, G: 200, B: 10, A: 255}
+	blue := color.RGBA{R: 10, G: 10, B: 200, A: 255}
+	src := color.Palette{red, green, blue}
+	dst := color.Palette{
+		color.RGBA{R: 20, G: 20, B: 220, A: 255},
+		color.RGBA{R: 220, G: 20, B: 20, A: 255},
+		color.RGBA{R: 128, G: 128, B: 128, A: 255},
+		color.RGBA{R: 20, G: 220, B: 20, A: 255},
+	}
+	expect := NewMapWithPalette(dst)
+	expect.Set(red, dst[1])
+	expect.Set(green, dst[3])
+	expect.Set(blue, dst[0])
+	for _, name := range DistanceNames() {
+		t.Run(name, func(t *testing.T) {
+			dist, err := ParseDistance(name)
+			require.NoError(t, err)
+
+			greedy, err := MapNearestGreedyDistance(src, dst, dist)
+			require.NoError(t, err)
+			require.Equal(t, expect, greedy)
+
+			bruteForce, err := MapNearestBruteForceDistance(src, dst, dist)
+			require.NoError(t, err)
+			require.Equal(t, expect, bruteForce)
+			require.Greater(t, bruteForce.ComputeErrorDistance(dist), 0.0)
+		})
+	}
+	_, err := ParseDistance("bogus")
+	require.Error(t, err)
+}
+
+func TestComputeErrorDistanceRGB(t *testing.T) {
+	m := NewMap()
+	m.Set(color.RGBA{R: 1, G: 2, B: 3, A: 255}, color.RGBA{R: 4, G: 5, B: 6, A: 255})
+	m.Set(color.RGBA{R: 100, G: 2, B: 3, A: 255}, color.RGBA{R: 4, G: 50, B: 6, A: 255})
+	m.Set(color.RGBA{R: 10, G: 20, B: 30, A: 255}, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	require.Equal(t, float64(m.ComputeError()), m.ComputeErrorDistance(DistanceRGB))
+}
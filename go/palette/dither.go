@@ -0,0 +1,307 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MaxColors is the largest palette which a Ditherer can use, since an
+// image.Paletted stores the palette index of each pixel in a uint8.
+const MaxColors = 256
+
+// CheckPalette returns an error if the palette cannot be used by a Ditherer,
+// ie. if it is empty or has more than MaxColors colors.
+func CheckPalette(p color.Palette) error {
+	if len(p) == 0 || len(p) > MaxColors {
+		return fmt.Errorf("palette must have between 1 and %d colors to be applied to an image, but has %d", MaxColors, len(p))
+	}
+	return nil
+}
+
+// Ditherer renders an image using a limited color.Palette.
+type Ditherer interface {
+	// Dither returns a new image.Paletted with the given palette which
+	// approximates the source image. The palette must be valid according to
+	// CheckPalette.
+	Dither(src image.Image, p color.Palette) *image.Paletted
+}
+
+// NoDither is a Ditherer which simply maps each pixel to the nearest color in
+// the palette.
+type NoDither struct{}
+
+// Dither implements Ditherer.
+func (NoDither) Dither(src image.Image, p color.Palette) *image.Paletted {
+	bounds := src.Bounds()
+	rv := image.NewPaletted(bounds, p)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rv.SetColorIndex(x, y, uint8(p.Index(src.At(x, y))))
+		}
+	}
+	return rv
+}
+
+// DiffusionWeight describes the share of quantization error which is passed
+// to a single neighboring pixel.
+type DiffusionWeight struct {
+	// DX and DY give the offset of the neighbor from the current pixel. DX is
+	// relative to the scan direction; it is mirrored for right-to-left rows
+	// when scanning in serpentine order.
+	DX, DY int
+	Weight int
+}
+
+// DiffusionKernel describes how quantization error is distributed to
+// neighboring pixels. Each neighbor receives Weight/Divisor of the error.
+type DiffusionKernel struct {
+	Divisor int
+	Weights []DiffusionWeight
+}
+
+// Well-known error diffusion kernels.
+var (
+	FloydSteinberg = DiffusionKernel{
+		Divisor: 16,
+		Weights: []DiffusionWeight{
+			{1, 0, 7},
+			{-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+		},
+	}
+	JarvisJudiceNinke = DiffusionKernel{
+		Divisor: 48,
+		Weights: []DiffusionWeight{
+			{1, 0, 7}, {2, 0, 5},
+			{-2, 1, 3}, {-1, 1, 5}, {0, 1, 7}, {1, 1, 5}, {2, 1, 3},
+			{-2, 2, 1}, {-1, 2, 3}, {0, 2, 5}, {1, 2, 3}, {2, 2, 1},
+		},
+	}
+	Stucki = DiffusionKernel{
+		Divisor: 42,
+		Weights: []DiffusionWeight{
+			{1, 0, 8}, {2, 0, 4},
+			{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+			{-2, 2, 1}, {-1, 2, 2}, {0, 2, 4}, {1, 2, 2}, {2, 2, 1},
+		},
+	}
+	Burkes = DiffusionKernel{
+		Divisor: 32,
+		Weights: []DiffusionWeight{
+			{1, 0, 8}, {2, 0, 4},
+			{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+		},
+	}
+	Sierra = DiffusionKernel{
+		Divisor: 32,
+		Weights: []DiffusionWeight{
+			{1, 0, 5}, {2, 0, 3},
+			{-2, 1, 2}, {-1, 1, 4}, {0, 1, 5}, {1, 1, 4}, {2, 1, 2},
+			{-1, 2, 2}, {0, 2, 3}, {1, 2, 2},
+		},
+	}
+	SierraTwoRow = DiffusionKernel{
+		Divisor: 16,
+		Weights: []DiffusionWeight{
+			{1, 0, 4}, {2, 0, 3},
+			{-2, 1, 1}, {-1, 1, 2}, {0, 1, 3}, {1, 1, 2}, {2, 1, 1},
+		},
+	}
+	SierraLite = DiffusionKernel{
+		Divisor: 4,
+		Weights: []DiffusionWeight{
+			{1, 0, 2},
+			{-1, 1, 1}, {0, 1, 1},
+		},
+	}
+	// Atkinson intentionally diffuses only 3/4 of the error, which gives
+	// higher contrast at the cost of detail in highlights and shadows.
+	Atkinson = DiffusionKernel{
+		Divisor: 8,
+		Weights: []DiffusionWeight{
+			{1, 0, 1}, {2, 0, 1},
+			{-1, 1, 1}, {0, 1, 1}, {1, 1, 1},
+			{0, 2, 1},
+		},
+	}
+)
+
+// ErrorDiffusion is a Ditherer which maps each pixel to the nearest palette
+// color and distributes the resulting error to neighboring pixels which have
+// not yet been visited.
+type ErrorDiffusion struct {
+	Kernel DiffusionKernel
+	// Serpentine alternates the scan direction on each row, which reduces
+	// directional artifacts.
+	Serpentine bool
+	// Strength scales the amount of error which is diffused. 1.0 diffuses
+	// the full error, while 0 is equivalent to NoDither.
+	Strength float64
+}
+
+// Dither implements Ditherer.
+func (d ErrorDiffusion) Dither(src image.Image, p color.Palette) *image.Paletted {
+	bounds := src.Bounds()
+	rv := image.NewPaletted(bounds, p)
+	if len(p) == 0 {
+		return rv
+	}
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Working buffer of 16-bit channel values, including accumulated error.
+	buf := make([]float64, width*height*3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			i := (y*width + x) * 3
+			buf[i], buf[i+1], buf[i+2] = float64(r), float64(g), float64(b)
+		}
+	}
+	paletteRGB := paletteChannels(p)
+	scale := d.Strength / float64(d.Kernel.Divisor)
+
+	for y := 0; y < height; y++ {
+		reverse := d.Serpentine && y%2 == 1
+		for step := 0; step < width; step++ {
+			x := step
+			if reverse {
+				x = width - 1 - step
+			}
+			i := (y*width + x) * 3
+			r, g, b := clampChannel(buf[i]), clampChannel(buf[i+1]), clampChannel(buf[i+2])
+			idx := nearestIndex(paletteRGB, r, g, b)
+			rv.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(idx))
+			if scale == 0 {
+				continue
+			}
+			errR := (r - paletteRGB[idx][0]) * scale
+			errG := (g - paletteRGB[idx][1]) * scale
+			errB := (b - paletteRGB[idx][2]) * scale
+			for _, w := range d.Kernel.Weights {
+				dx := w.DX
+				if reverse {
+					dx = -dx
+				}
+				nx, ny := x+dx, y+w.DY
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+				ni := (ny*width + nx) * 3
+				weight := float64(w.Weight)
+				buf[ni] += errR * weight
+				buf[ni+1] += errG * weight
+				buf[ni+2] += errB * weight
+			}
+		}
+	}
+	return rv
+}
+
+// paletteChannels returns the 16-bit RGB channels of each color in the
+// palette.
+func paletteChannels(p color.Palette) [][3]float64 {
+	rv := make([][3]float64, len(p))
+	for idx, c := range p {
+		r, g, b, _ := c.RGBA()
+		rv[idx] = [3]float64{float64(r), float64(g), float64(b)}
+	}
+	return rv
+}
+
+// nearestIndex returns the index of the palette entry nearest to the given
+// 16-bit channel values.
+func nearestIndex(paletteRGB [][3]float64, r, g, b float64) int {
+	best := 0
+	bestDist := math.Inf(1)
+	for idx, c := range paletteRGB {
+		dr, dg, db := r-c[0], g-c[1], b-c[2]
+		if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+			bestDist = dist
+			best = idx
+		}
+	}
+	return best
+}
+
+func clampChannel(v float64) float64 {
+	if v < 0 {
+		return 0
+	} else if v > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return v
+}
+
+// DitherOptions holds settings which apply to Ditherers created by name using
+// NewDitherer. Not all settings apply to all Ditherers.
+type DitherOptions struct {
+	// Strength scales the dithering effect; 1.0 is the default.
+	Strength float64
+	// Serpentine alternates the scan direction on each row, for error
+	// diffusion Ditherers.
+	Serpentine bool
+	// ThresholdMap is used by the "threshold-map" ordered Ditherer.
+	ThresholdMap *ThresholdMap
+}
+
+var ditherers = map[string]func(DitherOptions) (Ditherer, error){
+	"none": func(DitherOptions) (Ditherer, error) {
+		return NoDither{}, nil
+	},
+}
+
+// registerDiffusion registers an ErrorDiffusion Ditherer using the given
+// kernel.
+func registerDiffusion(name string, kernel DiffusionKernel) {
+	ditherers[name] = func(opts DitherOptions) (Ditherer, error) {
+		return ErrorDiffusion{
+			Kernel:     kernel,
+			Serpentine: opts.Serpentine,
+			Strength:   opts.Strength,
+		}, nil
+	}
+}
+
+func init() {
+	registerDiffusion("floyd-steinberg", FloydSteinberg)
+	registerDiffusion("jarvis-judice-ninke", JarvisJudiceNinke)
+	registerDiffusion("stucki", Stucki)
+	registerDiffusion("burkes", Burkes)
+	registerDiffusion("sierra", Sierra)
+	registerDiffusion("sierra-two-row", SierraTwoRow)
+	registerDiffusion("sierra-lite", SierraLite)
+	registerDiffusion("atkinson", Atkinson)
+}
+
+// DithererNames returns the names of all Ditherers which may be created
+// using NewDitherer, sorted.
+func DithererNames() []string {
+	rv := make([]string, 0, len(ditherers))
+	for name := range ditherers {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// NewDitherer returns the Ditherer with the given name.
+func NewDitherer(name string, opts DitherOptions) (Ditherer, error) {
+	fn, ok := ditherers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown dithering mode %q; known modes: %s", name, strings.Join(DithererNames(), ", "))
+	}
+	return fn(opts)
+}
+
+// ApplyDithered returns a new image.Paletted with the palette mapping applied
+// to the given source image, which may have any number of colors. The source
+// image is first dithered using the Map's source colors.
+func (m *Map) ApplyDithered(src image.Image, d Ditherer) (*image.Paletted, error) {
+	if err := CheckPalette(m.src); err != nil {
+		return nil, err
+	}
+	return m.Apply(d.Dither(src, m.Source()))
+}
@@ -0,0 +1,128 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gradientImage returns a horizontal greyscale gradient.
+func gradientImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			v := uint8(x * 255 / (width - 1))
+			img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+// countWhite returns the fraction of pixels in the image which are white.
+func countWhite(img *image.Paletted) float64 {
+	count := 0
+	for _, idx := range img.Pix {
+		if r, _, _, _ := img.Palette[idx].RGBA(); r == 0xffff {
+			count++
+		}
+	}
+	return float64(count) / float64(len(img.Pix))
+}
+
+var blackAndWhite = color.Palette{color.Black, color.White}
+
+// requireDitherLevels asserts that the Ditherer renders flat grey levels with
+// the corresponding proportion of white pixels.
+func requireDitherLevels(t *testing.T, d Ditherer) {
+	for level := 0; level < 256; level += 15 {
+		img := image.NewRGBA(image.Rect(0, 0, 37, 29))
+		draw.Draw(img, img.Rect, image.NewUniform(color.Gray{Y: uint8(level)}), image.Point{}, draw.Src)
+		actual := d.Dither(img, blackAndWhite)
+		require.InDelta(t, float64(level)/255, countWhite(actual), 0.05, "%T level %d", d, level)
+	}
+}
+
+func TestNoDither(t *testing.T) {
+	src := gradientImage(32, 8)
+	p := Subdivide(3)
+	expect := image.NewPaletted(src.Bounds(), p)
+	draw.Draw(expect, expect.Rect, src, src.Bounds().Min, draw.Src)
+	require.Equal(t, expect, NoDither{}.Dither(src, p))
+}
+
+func TestCheckPalette(t *testing.T) {
+	require.NoError(t, CheckPalette(Subdivide(2)))
+	require.NoError(t, CheckPalette(Subdivide(7)[:MaxColors]))
+	require.Error(t, CheckPalette(nil))
+	// 343 colors would wrap around the uint8 palette indexes.
+	require.Error(t, CheckPalette(Subdivide(7)))
+
+	m := NewMap()
+	for _, c := range Subdivide(7) {
+		m.Set(c, c)
+	}
+	_, err := m.Apply(NoDither{}.Dither(gradientImage(4, 4), blackAndWhite))
+	require.Error(t, err)
+}
+
+func TestNewDitherer(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(src, src.Rect, image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+	thresholdMap, err := Bayer(4)
+	require.NoError(t, err)
+	for _, name := range DithererNames() {
+		t.Run(name, func(t *testing.T) {
+			d, err := NewDitherer(name, DitherOptions{Strength: 1, Serpentine: true, ThresholdMap: &thresholdMap})
+			require.NoError(t, err)
+			actual := d.Dither(src, blackAndWhite)
+			if name == "none" {
+				require.Equal(t, 1.0, countWhite(actual))
+			} else {
+				require.InDelta(t, 0.5, countWhite(actual), 0.05)
+			}
+		})
+	}
+	_, err = NewDitherer("bogus", DitherOptions{})
+	require.Error(t, err)
+}
+
+func TestErrorDiffusionZeroStrength(t *testing.T) {
+	src := gradientImage(32, 8)
+	d := ErrorDiffusion{Kernel: FloydSteinberg, Strength: 0}
+	require.Equal(t, NoDither{}.Dither(src, blackAndWhite), d.Dither(src, blackAndWhite))
+}
+
+func TestDiffusionKernels(t *testing.T) {
+	for _, k := range []DiffusionKernel{FloydSteinberg, JarvisJudiceNinke, Stucki, Burkes, Sierra, SierraTwoRow, SierraLite} {
+		total := 0
+		for _, w := range k.Weights {
+			require.True(t, w.DY > 0 || w.DX > 0, "kernel must only diffuse forward")
+			total += w.Weight
+		}
+		require.Equal(t, k.Divisor, total)
+	}
+}
+
+func TestApplyDithered(t *testing.T) {
+	src := gradientImage(64, 8)
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	m, err := MapDirect(blackAndWhite, color.Palette{red, blue})
+	require.NoError(t, err)
+	actual, err := m.ApplyDithered(src, ErrorDiffusion{Kernel: FloydSteinberg, Strength: 1})
+	require.NoError(t, err)
+	reds := 0
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 8; y++ {
+			c := actual.At(x, y)
+			require.True(t, c == red || c == blue)
+			if c == red {
+				reds++
+			}
+		}
+	}
+	require.InDelta(t, 0.5, float64(reds)/(64*8), 0.05)
+}
@@ -0,0 +1,108 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// MapOptimal creates the one-to-one Map from src to dst with the least total
+// error, as computed by Map.ComputeError. Unlike MapNearestBruteForce, it runs
+// in O(n^3) time using the Hungarian algorithm, so it is practical for full
+// 256-color palettes. The dst palette may be larger than src, in which case
+// some dst colors are left unused.
+func MapOptimal(src, dst color.Palette) (*Map, error) {
+	return MapOptimalDistance(src, dst, DistanceRGB)
+}
+
+// MapOptimalDistance is like MapOptimal, but minimizes the total error as
+// measured by the given Distance.
+func MapOptimalDistance(src, dst color.Palette, distance Distance) (*Map, error) {
+	if len(dst) < len(src) {
+		return nil, fmt.Errorf("dst palette has fewer colors than the src, %d vs %d", len(dst), len(src))
+	}
+	cost := make([][]float64, len(src))
+	for i, srcColor := range src {
+		cost[i] = make([]float64, len(dst))
+		for j, dstColor := range dst {
+			cost[i][j] = distance(srcColor, dstColor)
+		}
+	}
+	return mapFromAssignment(src, dst, hungarian(cost)), nil
+}
+
+// hungarian solves the rectangular assignment problem for the given cost
+// matrix, which must have no more rows than columns. It returns the column
+// assigned to each row such that the total cost is minimized. This is the
+// Kuhn-Munkres algorithm using row and column potentials and shortest
+// augmenting paths, which runs in O(n^2 m) time for n rows and m columns.
+func hungarian(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 {
+		return nil
+	}
+	m := len(cost[0])
+
+	// The algorithm is simplest with 1-based indexes, using column 0 as a
+	// sentinel for the row currently being added.
+	u := make([]float64, n+1) // Row potentials.
+	v := make([]float64, m+1) // Column potentials.
+	match := make([]int, m+1) // match[j] is the row assigned to column j.
+	way := make([]int, m+1)   // way[j] is the previous column on the path to j.
+	minSlack := make([]float64, m+1)
+	used := make([]bool, m+1)
+	for i := 1; i <= n; i++ {
+		match[0] = i
+		j0 := 0
+		for j := range minSlack {
+			minSlack[j] = math.Inf(1)
+			used[j] = false
+		}
+		for {
+			used[j0] = true
+			i0 := match[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				slack := cost[i0-1][j-1] - u[i0] - v[j]
+				if slack < minSlack[j] {
+					minSlack[j] = slack
+					way[j] = j0
+				}
+				if minSlack[j] < delta {
+					delta = minSlack[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[match[j]] += delta
+					v[j] -= delta
+				} else {
+					minSlack[j] -= delta
+				}
+			}
+			j0 = j1
+			if match[j0] == 0 {
+				break
+			}
+		}
+		// Augment along the path back to the sentinel.
+		for j0 != 0 {
+			j1 := way[j0]
+			match[j0] = match[j1]
+			j0 = j1
+		}
+	}
+
+	rv := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if match[j] != 0 {
+			rv[match[j]-1] = j - 1
+		}
+	}
+	return rv
+}
@@ -0,0 +1,70 @@
+package palette
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomPalette(r *rand.Rand, n int) color.Palette {
+	rv := make(color.Palette, 0, n)
+	for i := 0; i < n; i++ {
+		rv = append(rv, color.RGBA{R: uint8(r.Intn(256)), G: uint8(r.Intn(256)), B: uint8(r.Intn(256)), A: 255})
+	}
+	return rv
+}
+
+func TestMapOptimalMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for trial := 0; trial < 50; trial++ {
+		numSrc := 1 + r.Intn(5)
+		numDst := numSrc + r.Intn(3)
+		src := randomPalette(r, numSrc)
+		dst := randomPalette(r, numDst)
+
+		expect, err := MapNearestBruteForce(src, dst)
+		require.NoError(t, err)
+		actual, err := MapOptimal(src, dst)
+		require.NoError(t, err)
+		require.Equal(t, expect.Len(), actual.Len())
+		require.Equal(t, expect.ComputeError(), actual.ComputeError(), "src %v dst %v", src, dst)
+
+		// Each dst color is used at most once.
+		used := map[color.Color]bool{}
+		actual.Range(func(_, c color.Color) {
+			require.False(t, used[c])
+			used[c] = true
+		})
+	}
+}
+
+func TestMapOptimalLarge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	src := randomPalette(r, 256)
+	dst := randomPalette(r, 256)
+	actual, err := MapOptimal(src, dst)
+	require.NoError(t, err)
+	require.Equal(t, 256, actual.Len())
+	greedy, err := MapNearestGreedy(src, dst)
+	require.NoError(t, err)
+	require.LessOrEqual(t, actual.ComputeError(), greedy.ComputeError())
+
+	// Mapping a palette onto a permutation of itself should have no error.
+	shuffled := append(color.Palette{}, src...)
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	identity, err := MapOptimal(src, shuffled)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), identity.ComputeError())
+}
+
+func TestMapOptimalErrors(t *testing.T) {
+	_, err := MapOptimal(Subdivide(2), Subdivide(1))
+	require.Error(t, err)
+	m, err := MapOptimal(nil, Subdivide(2))
+	require.NoError(t, err)
+	require.Equal(t, 0, m.Len())
+}
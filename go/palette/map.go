@@ -0,0 +1,314 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Key returns the canonical form of the given color, which Map uses to
+// compare colors. Colors of different types which represent the same color,
+// eg. color.RGBA{1, 2, 3, 255} and color.NRGBA{1, 2, 3, 255}, have the same
+// Key.
+func Key(c color.Color) color.RGBA64 {
+	return color.RGBA64Model.Convert(c).(color.RGBA64)
+}
+
+// Map describes a mapping from one color.Palette to another. This helps to
+// avoid multiple source colors "collapsing" onto a single destination color,
+// which is relevant when using palettes of limited size.
+//
+// Source colors are compared by Key, so that equal colors of different types
+// are treated as the same color. Entries are kept in insertion order, and the
+// destination palette has an explicit order, so that everything derived from a
+// Map, including the output of Apply, is deterministic.
+type Map struct {
+	src []color.Color
+	// dst holds the index into palette for each entry in src.
+	dst []int
+	// srcIndex maps the Key of each source color to its index in src.
+	srcIndex map[color.RGBA64]int
+
+	palette color.Palette
+	// paletteIndex maps the Key of each destination color to its index in
+	// palette.
+	paletteIndex map[color.RGBA64]int
+}
+
+// NewMap returns an empty Map.
+func NewMap() *Map {
+	return &Map{
+		srcIndex:     map[color.RGBA64]int{},
+		paletteIndex: map[color.RGBA64]int{},
+	}
+}
+
+// NewMapWithPalette returns an empty Map whose destination palette begins with
+// the given colors, in order. Duplicate colors are ignored.
+func NewMapWithPalette(p color.Palette) *Map {
+	m := NewMap()
+	for _, c := range p {
+		m.addToPalette(c)
+	}
+	return m
+}
+
+// addToPalette adds the color to the destination palette if it is not already
+// present, and returns its index.
+func (m *Map) addToPalette(c color.Color) int {
+	key := Key(c)
+	if idx, ok := m.paletteIndex[key]; ok {
+		return idx
+	}
+	m.palette = append(m.palette, c)
+	m.paletteIndex[key] = len(m.palette) - 1
+	return len(m.palette) - 1
+}
+
+// Set maps the src color to the dst color, replacing any existing mapping for
+// src. If dst is not yet in the destination palette, it is appended.
+func (m *Map) Set(src, dst color.Color) {
+	dstIdx := m.addToPalette(dst)
+	key := Key(src)
+	if idx, ok := m.srcIndex[key]; ok {
+		m.dst[idx] = dstIdx
+		return
+	}
+	m.src = append(m.src, src)
+	m.dst = append(m.dst, dstIdx)
+	m.srcIndex[key] = len(m.src) - 1
+}
+
+// Get returns the destination color for the given source color, and whether
+// it is present in the Map.
+func (m *Map) Get(src color.Color) (color.Color, bool) {
+	idx, ok := m.srcIndex[Key(src)]
+	if !ok {
+		return nil, false
+	}
+	return m.palette[m.dst[idx]], true
+}
+
+// Len returns the number of source colors in the Map.
+func (m *Map) Len() int {
+	return len(m.src)
+}
+
+// Source returns the source colors of the Map, in insertion order.
+func (m *Map) Source() color.Palette {
+	return append(color.Palette{}, m.src...)
+}
+
+// Palette returns the destination palette of the Map, in order. It may
+// include colors which no source color maps to.
+func (m *Map) Palette() color.Palette {
+	return append(color.Palette{}, m.palette...)
+}
+
+// SetPalette sets the order of the destination palette explicitly. The given
+// palette must contain every destination color of the Map, and may contain
+// additional colors.
+func (m *Map) SetPalette(p color.Palette) error {
+	newIndex := make(map[color.RGBA64]int, len(p))
+	for idx, c := range p {
+		key := Key(c)
+		if _, ok := newIndex[key]; ok {
+			return fmt.Errorf("palette contains duplicate color %+v", c)
+		}
+		newIndex[key] = idx
+	}
+	newDst := make([]int, len(m.dst))
+	for idx, dstIdx := range m.dst {
+		c := m.palette[dstIdx]
+		newIdx, ok := newIndex[Key(c)]
+		if !ok {
+			return fmt.Errorf("palette does not include destination color %+v", c)
+		}
+		newDst[idx] = newIdx
+	}
+	m.palette = append(color.Palette{}, p...)
+	m.paletteIndex = newIndex
+	m.dst = newDst
+	return nil
+}
+
+// Range calls fn for each source and destination color pair in the Map, in
+// insertion order.
+func (m *Map) Range(fn func(src, dst color.Color)) {
+	for idx, src := range m.src {
+		fn(src, m.palette[m.dst[idx]])
+	}
+}
+
+// Apply returns a new image.Paletted with the palette mapping applied to the
+// given source image.Paletted. The result uses the Map's destination palette.
+// If any colors in the source image are not in the Map, or the destination
+// palette has more than MaxColors colors, an error is returned.
+func (m *Map) Apply(src *image.Paletted) (*image.Paletted, error) {
+	if len(m.palette) > MaxColors {
+		return nil, fmt.Errorf("destination palette has %d colors; at most %d may be used in a paletted image", len(m.palette), MaxColors)
+	}
+	bounds := src.Bounds()
+	// Translate each index in the source palette up front. Colors which are
+	// missing from the Map are only an error if they are actually used.
+	lookup := make([]int, len(src.Palette))
+	for idx, c := range src.Palette {
+		lookup[idx] = -1
+		if srcIdx, ok := m.srcIndex[Key(c)]; ok {
+			lookup[idx] = m.dst[srcIdx]
+		}
+	}
+	rv := image.NewPaletted(bounds, m.Palette())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			srcIdx := int(src.ColorIndexAt(x, y))
+			if srcIdx >= len(lookup) {
+				return nil, fmt.Errorf("source image has invalid color index %d at (%d, %d)", srcIdx, x, y)
+			}
+			if lookup[srcIdx] < 0 {
+				return nil, fmt.Errorf("source palette does not include color %+v", src.Palette[srcIdx])
+			}
+			rv.SetColorIndex(x, y, uint8(lookup[srcIdx]))
+		}
+	}
+	return rv, nil
+}
+
+// ComputeError returns the total error (squared Euclidean distance between
+// source and destination colors) of the map.
+func (m *Map) ComputeError() int64 {
+	total := int64(0)
+	m.Range(func(src, dst color.Color) {
+		total += ColorToPoint(src).SqDist(ColorToPoint(dst))
+	})
+	return total
+}
+
+// ComputeErrorDistance returns the total error of the map, as measured by the
+// given Distance between source and destination colors.
+func (m *Map) ComputeErrorDistance(dist Distance) float64 {
+	total := 0.0
+	m.Range(func(src, dst color.Color) {
+		total += dist(src, dst)
+	})
+	return total
+}
+
+// Fallback describes how ApplyImage handles colors which are not in the Map.
+type Fallback int
+
+const (
+	// FallbackError causes ApplyImage to return an error.
+	FallbackError Fallback = iota
+	// FallbackNearestSource maps the color as if it were the nearest source
+	// color in the Map.
+	FallbackNearestSource
+	// FallbackNearestDestination replaces the color with the nearest color in
+	// the destination palette.
+	FallbackNearestDestination
+	// FallbackPassThrough leaves the color unchanged.
+	FallbackPassThrough
+)
+
+var fallbackNames = []string{"error", "nearest-source", "nearest-destination", "pass-through"}
+
+// String implements fmt.Stringer.
+func (f Fallback) String() string {
+	if int(f) >= 0 && int(f) < len(fallbackNames) {
+		return fallbackNames[f]
+	}
+	return fmt.Sprintf("Fallback(%d)", int(f))
+}
+
+// ParseFallback returns the Fallback with the given name.
+func ParseFallback(name string) (Fallback, error) {
+	for idx, fallbackName := range fallbackNames {
+		if name == fallbackName {
+			return Fallback(idx), nil
+		}
+	}
+	return FallbackError, fmt.Errorf("unknown fallback %q; known fallbacks: %s", name, strings.Join(fallbackNames, ", "))
+}
+
+// ApplyImage returns a new image with the palette mapping applied to the given
+// source image, which may be of any type, eg. an *image.YCbCr decoded from a
+// JPEG. Colors are matched ignoring alpha, and the alpha of each source pixel
+// is preserved in the result. Colors which are not in the Map are handled
+// according to the given Fallback.
+func (m *Map) ApplyImage(src image.Image, fallback Fallback) (*image.NRGBA, error) {
+	bounds := src.Bounds()
+	rv := image.NewNRGBA(bounds)
+	srcChannels := paletteChannels(m.src)
+	dstChannels := paletteChannels(m.palette)
+	// Photos contain many repeated colors, so cache the result for each.
+	cache := map[color.RGBA64]color.NRGBA64{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(src.At(x, y)).(color.NRGBA64)
+			opaque := color.RGBA64{R: c.R, G: c.G, B: c.B, A: 0xffff}
+			out, ok := cache[opaque]
+			if !ok {
+				var dst color.Color
+				if idx, ok := m.srcIndex[opaque]; ok {
+					dst = m.palette[m.dst[idx]]
+				} else {
+					switch fallback {
+					case FallbackNearestSource:
+						if len(m.src) == 0 {
+							return nil, fmt.Errorf("cannot find nearest source color in an empty Map")
+						}
+						idx := nearestIndex(srcChannels, float64(c.R), float64(c.G), float64(c.B))
+						dst = m.palette[m.dst[idx]]
+					case FallbackNearestDestination:
+						if len(m.palette) == 0 {
+							return nil, fmt.Errorf("cannot find nearest destination color in an empty Map")
+						}
+						dst = m.palette[nearestIndex(dstChannels, float64(c.R), float64(c.G), float64(c.B))]
+					case FallbackPassThrough:
+						dst = opaque
+					default:
+						return nil, fmt.Errorf("source palette does not include color %+v", src.At(x, y))
+					}
+				}
+				out = color.NRGBA64Model.Convert(dst).(color.NRGBA64)
+				cache[opaque] = out
+			}
+			out.A = c.A
+			rv.Set(x, y, out)
+		}
+	}
+	return rv, nil
+}
+
+// Compose returns a Map which maps each source color of m to the color which
+// next maps m's destination color to, ie. it applies m and then next. Every
+// destination color of m must be a source color of next. The destination
+// palette of the result is ordered as that of next.
+func (m *Map) Compose(next *Map) (*Map, error) {
+	rv := NewMapWithPalette(next.palette)
+	for idx, src := range m.src {
+		mid := m.palette[m.dst[idx]]
+		dst, ok := next.Get(mid)
+		if !ok {
+			return nil, fmt.Errorf("cannot compose maps; second map does not include color %s", ColorToHex(mid))
+		}
+		rv.Set(src, dst)
+	}
+	return rv, nil
+}
+
+// Invert returns a Map from each destination color of m back to its source
+// color. m must be one-to-one. The destination palette of the result is
+// ordered as the source colors of m.
+func (m *Map) Invert() (*Map, error) {
+	rv := NewMapWithPalette(m.src)
+	for idx, src := range m.src {
+		dst := m.palette[m.dst[idx]]
+		if prev, ok := rv.Get(dst); ok {
+			return nil, fmt.Errorf("cannot invert map; both %s and %s map to %s", ColorToHex(prev), ColorToHex(src), ColorToHex(dst))
+		}
+		rv.Set(dst, src)
+	}
+	return rv, nil
+}
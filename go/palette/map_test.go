@@ -0,0 +1,166 @@
+package palette
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireMapsTo asserts that the Map maps src to dst.
+func requireMapsTo(t *testing.T, m *Map, src, dst color.Color) {
+	actual, ok := m.Get(src)
+	require.True(t, ok, "map does not include %+v", src)
+	require.Equal(t, Key(dst), Key(actual))
+}
+
+func TestMapCanonicalKeys(t *testing.T) {
+	m := NewMap()
+	m.Set(color.RGBA{R: 1, G: 2, B: 3, A: 255}, color.White)
+	requireMapsTo(t, m, color.NRGBA{R: 1, G: 2, B: 3, A: 255}, color.White)
+	requireMapsTo(t, m, color.RGBA64{R: 0x0101, G: 0x0202, B: 0x0303, A: 0xffff}, color.White)
+	_, ok := m.Get(color.RGBA{R: 1, G: 2, B: 4, A: 255})
+	require.False(t, ok)
+
+	// Setting an equal color replaces the existing entry.
+	m.Set(color.NRGBA{R: 1, G: 2, B: 3, A: 255}, color.Black)
+	require.Equal(t, 1, m.Len())
+	requireMapsTo(t, m, color.RGBA{R: 1, G: 2, B: 3, A: 255}, color.Black)
+	require.Equal(t, color.Palette{color.White, color.Black}, m.Palette())
+}
+
+func TestMapPaletteOrder(t *testing.T) {
+	src := Subdivide(2)
+	dst := color.Palette(SortedByLuminosity(Monochrome(color.RGBA{R: 200, G: 50, B: 50, A: 255}, len(src))))
+	m, err := MapByLuminosity(src, dst)
+	require.NoError(t, err)
+	require.Equal(t, dst, m.Palette())
+
+	reversed := make(color.Palette, 0, len(dst))
+	for idx := len(dst) - 1; idx >= 0; idx-- {
+		reversed = append(reversed, dst[idx])
+	}
+	require.NoError(t, m.SetPalette(reversed))
+	require.Equal(t, reversed, m.Palette())
+	for idx, c := range SortedByLuminosity(src) {
+		requireMapsTo(t, m, c, dst[idx])
+	}
+
+	require.Error(t, m.SetPalette(reversed[1:]))
+	require.Error(t, m.SetPalette(append(reversed, reversed[0])))
+}
+
+func TestMapApply(t *testing.T) {
+	srcPalette := color.Palette{
+		color.RGBA{R: 255, A: 255},
+		color.RGBA{G: 255, A: 255},
+		color.RGBA{B: 255, A: 255},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 3, 2), srcPalette)
+	for x := 0; x < 3; x++ {
+		img.SetColorIndex(x, 0, uint8(x))
+		img.SetColorIndex(x, 1, uint8(2-x))
+	}
+	// Keys of a different color type must still match.
+	m := NewMap()
+	m.Set(color.NRGBA{R: 255, A: 255}, color.White)
+	m.Set(color.NRGBA{G: 255, A: 255}, color.Black)
+	m.Set(color.NRGBA{B: 255, A: 255}, color.White)
+
+	actual, err := m.Apply(img)
+	require.NoError(t, err)
+	require.Equal(t, color.Palette{color.White, color.Black}, actual.Palette)
+	require.Equal(t, []uint8{0, 1, 0, 0, 1, 0}, actual.Pix)
+
+	missing := NewMap()
+	missing.Set(srcPalette[0], color.White)
+	_, err = missing.Apply(img)
+	require.Error(t, err)
+}
+
+func TestMapApplyReproducible(t *testing.T) {
+	src := gradientImage(64, 16)
+	srcPalette := Subdivide(3)
+	img := NoDither{}.Dither(src, srcPalette)
+	dstPalette := make(color.Palette, 0, len(srcPalette))
+	for _, c := range srcPalette {
+		dstPalette = append(dstPalette, InvertColor(c))
+	}
+
+	encode := func() ([]byte, []byte) {
+		m, err := MapNearestGreedy(srcPalette, dstPalette)
+		require.NoError(t, err)
+		out, err := m.Apply(img)
+		require.NoError(t, err)
+		var pngBuf, gifBuf bytes.Buffer
+		require.NoError(t, png.Encode(&pngBuf, out))
+		require.NoError(t, gif.Encode(&gifBuf, out, nil))
+		return pngBuf.Bytes(), gifBuf.Bytes()
+	}
+	expectPNG, expectGIF := encode()
+	for i := 0; i < 10; i++ {
+		actualPNG, actualGIF := encode()
+		require.Equal(t, expectPNG, actualPNG)
+		require.Equal(t, expectGIF, actualGIF)
+	}
+}
+
+func TestMapApplyImage(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	m := NewMap()
+	m.Set(red, color.White)
+	m.Set(blue, color.Black)
+
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	src.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	src.Set(1, 0, color.NRGBA{B: 255, A: 255})
+	src.Set(2, 0, color.NRGBA{R: 200, G: 10, B: 60, A: 255})
+
+	test := func(fallback Fallback, expect []color.NRGBA) {
+		t.Run(fallback.String(), func(t *testing.T) {
+			actual, err := m.ApplyImage(src, fallback)
+			require.NoError(t, err)
+			for x, c := range expect {
+				require.Equal(t, c, actual.NRGBAAt(x, 0), "pixel %d", x)
+			}
+		})
+	}
+	test(FallbackNearestSource, []color.NRGBA{
+		{R: 255, G: 255, B: 255, A: 128},
+		{A: 255},
+		{R: 255, G: 255, B: 255, A: 255},
+	})
+	test(FallbackNearestDestination, []color.NRGBA{
+		{R: 255, G: 255, B: 255, A: 128},
+		{A: 255},
+		{A: 255},
+	})
+	test(FallbackPassThrough, []color.NRGBA{
+		{R: 255, G: 255, B: 255, A: 128},
+		{A: 255},
+		{R: 200, G: 10, B: 60, A: 255},
+	})
+	_, err := m.ApplyImage(src, FallbackError)
+	require.Error(t, err)
+
+	// JPEG images decode as YCbCr.
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 2, 2), image.YCbCrSubsampleRatio444)
+	actual, err := m.ApplyImage(ycbcr, FallbackNearestDestination)
+	require.NoError(t, err)
+	require.Equal(t, color.NRGBA{A: 255}, actual.NRGBAAt(0, 0))
+}
+
+func TestParseFallback(t *testing.T) {
+	for _, f := range []Fallback{FallbackError, FallbackNearestSource, FallbackNearestDestination, FallbackPassThrough} {
+		actual, err := ParseFallback(f.String())
+		require.NoError(t, err)
+		require.Equal(t, f, actual)
+	}
+	_, err := ParseFallback("bogus")
+	require.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package palette
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// mapJSON is the JSON representation of a Map. Pairs holds each source and
+// destination color as hex strings, in order. Palette holds the destination
+// palette, so that its order and any unused colors are preserved.
+type mapJSON struct {
+	Pairs   [][2]string `json:"pairs"`
+	Palette []string    `json:"palette,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	v := mapJSON{
+		Pairs:   make([][2]string, 0, len(m.src)),
+		Palette: make([]string, 0, len(m.palette)),
+	}
+	m.Range(func(src, dst color.Color) {
+		v.Pairs = append(v.Pairs, [2]string{ColorToHex(src), ColorToHex(dst)})
+	})
+	for _, c := range m.palette {
+		v.Palette = append(v.Palette, ColorToHex(c))
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *Map) UnmarshalJSON(b []byte) error {
+	var v mapJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	palette := make(color.Palette, 0, len(v.Palette))
+	for _, hex := range v.Palette {
+		c, err := HexToColor(hex)
+		if err != nil {
+			return err
+		}
+		palette = append(palette, c)
+	}
+	rv := NewMapWithPalette(palette)
+	for _, pair := range v.Pairs {
+		src, err := HexToColor(pair[0])
+		if err != nil {
+			return err
+		}
+		dst, err := HexToColor(pair[1])
+		if err != nil {
+			return err
+		}
+		rv.Set(src, dst)
+	}
+	*m = *rv
+	return nil
+}
+
+// LUT1D returns the Map as a 1D lookup table image, with one column per entry.
+// The first row holds the source colors and the second row holds the
+// corresponding destination colors.
+func (m *Map) LUT1D() *image.NRGBA {
+	rv := image.NewNRGBA(image.Rect(0, 0, len(m.src), 2))
+	for idx, src := range m.src {
+		rv.Set(idx, 0, src)
+		rv.Set(idx, 1, m.palette[m.dst[idx]])
+	}
+	return rv
+}
+
+// MapFromLUT1D creates a Map from a 1D lookup table image, as produced by
+// LUT1D.
+func MapFromLUT1D(img image.Image) (*Map, error) {
+	bounds := img.Bounds()
+	if bounds.Dy() != 2 {
+		return nil, fmt.Errorf("1D LUT image must have exactly two rows, found %d", bounds.Dy())
+	}
+	rv := NewMap()
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		rv.Set(lutColor(img.At(x, bounds.Min.Y)), lutColor(img.At(x, bounds.Min.Y+1)))
+	}
+	return rv, nil
+}
+
+// lutColor converts a color read from a LUT image to a concrete type, so that
+// Maps read from LUT images compare and serialize predictably.
+func lutColor(c color.Color) color.Color {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == math.MaxUint8 {
+		return color.RGBA{R: n.R, G: n.G, B: n.B, A: n.A}
+	}
+	return n
+}
+
+// lutLatticeColor returns the color at the given lattice point of a 3D LUT
+// with the given size.
+func lutLatticeColor(size, r, g, b int) color.RGBA {
+	scale := func(v int) uint8 {
+		return uint8(math.Round(float64(v) * math.MaxUint8 / float64(size-1)))
+	}
+	return color.RGBA{R: scale(r), G: scale(g), B: scale(b), A: math.MaxUint8}
+}
+
+// LUT3D returns the Map as a 3D lookup table image which samples the RGB cube
+// at size points along each axis. The image is size^2 pixels wide and size
+// pixels tall; the lattice point (r, g, b) is stored at x = r + b*size, y = g.
+// Lattice colors which are not in the Map are handled according to the given
+// Fallback, which is typically FallbackNearestSource.
+func (m *Map) LUT3D(size int, fallback Fallback) (*image.NRGBA, error) {
+	if size < 2 || size > 256 {
+		return nil, fmt.Errorf("invalid 3D LUT size %d; must be between 2 and 256", size)
+	}
+	lattice := image.NewRGBA(image.Rect(0, 0, size*size, size))
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				lattice.SetRGBA(r+b*size, g, lutLatticeColor(size, r, g, b))
+			}
+		}
+	}
+	return m.ApplyImage(lattice, fallback)
+}
+
+// MapFromLUT3D creates a Map from a 3D lookup table image, as produced by
+// LUT3D. The resulting Map has an entry for each lattice point; use
+// FallbackNearestSource to apply it to colors between lattice points.
+func MapFromLUT3D(img image.Image) (*Map, error) {
+	bounds := img.Bounds()
+	size := bounds.Dy()
+	if size < 2 || bounds.Dx() != size*size {
+		return nil, fmt.Errorf("3D LUT image must be size^2 by size pixels, found %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	rv := NewMap()
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				rv.Set(lutLatticeColor(size, r, g, b), lutColor(img.At(bounds.Min.X+r+b*size, bounds.Min.Y+g)))
+			}
+		}
+	}
+	return rv, nil
+}
@@ -0,0 +1,128 @@
+package palette
+
+import (
+	"encoding/json"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testMap(t *testing.T) *Map {
+	src := Subdivide(2)
+	dst := InvertPalette(src)
+	m, err := MapDirect(src, dst)
+	require.NoError(t, err)
+	return m
+}
+
+func TestMapJSON(t *testing.T) {
+	m := testMap(t)
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `{"pairs":[["#000000","#ffffff"],["#0000ff","#ffff00"],`)
+
+	var actual Map
+	require.NoError(t, json.Unmarshal(b, &actual))
+	require.Equal(t, m.Len(), actual.Len())
+	require.Equal(t, len(m.Palette()), len(actual.Palette()))
+	m.Range(func(src, dst color.Color) {
+		requireMapsTo(t, &actual, src, dst)
+	})
+	for idx, c := range m.Palette() {
+		require.Equal(t, Key(c), Key(actual.Palette()[idx]))
+	}
+
+	// Round trip again; the output should be identical.
+	b2, err := json.Marshal(&actual)
+	require.NoError(t, err)
+	require.Equal(t, string(b), string(b2))
+
+	require.Error(t, json.Unmarshal([]byte(`{"pairs":[["#000000","bogus"]]}`), &actual))
+}
+
+func TestMapComposeInvert(t *testing.T) {
+	m := testMap(t)
+	inv, err := m.Invert()
+	require.NoError(t, err)
+	require.Equal(t, m.Source(), inv.Palette())
+
+	identity, err := m.Compose(inv)
+	require.NoError(t, err)
+	m.Range(func(src, _ color.Color) {
+		requireMapsTo(t, identity, src, src)
+	})
+
+	// Many-to-one maps cannot be inverted.
+	many := NewMap()
+	many.Set(color.White, color.Black)
+	many.Set(color.Opaque, color.Black)
+	many.Set(color.RGBA{R: 1, A: 255}, color.Black)
+	_, err = many.Invert()
+	require.Error(t, err)
+
+	// Composition requires every intermediate color.
+	_, err = many.Compose(m)
+	require.NoError(t, err)
+	_, err = m.Compose(many)
+	require.Error(t, err)
+}
+
+func TestMapLUT1D(t *testing.T) {
+	m := testMap(t)
+	lut := m.LUT1D()
+	require.Equal(t, m.Len(), lut.Bounds().Dx())
+	actual, err := MapFromLUT1D(lut)
+	require.NoError(t, err)
+	require.Equal(t, m.Len(), actual.Len())
+	m.Range(func(src, dst color.Color) {
+		requireMapsTo(t, actual, src, dst)
+	})
+}
+
+func TestMapLUT3D(t *testing.T) {
+	m := testMap(t)
+	lut, err := m.LUT3D(3, FallbackNearestSource)
+	require.NoError(t, err)
+	require.Equal(t, 9, lut.Bounds().Dx())
+	require.Equal(t, 3, lut.Bounds().Dy())
+
+	actual, err := MapFromLUT3D(lut)
+	require.NoError(t, err)
+	require.Equal(t, 27, actual.Len())
+	// Lattice points which coincide with the Map's entries map exactly.
+	m.Range(func(src, dst color.Color) {
+		requireMapsTo(t, actual, src, dst)
+	})
+	// The middle of the cube is slightly nearer to white than black, so it
+	// maps to the inverse of white.
+	requireMapsTo(t, actual, color.RGBA{R: 128, G: 128, B: 128, A: 255}, color.Black)
+
+	_, err = m.LUT3D(1, FallbackNearestSource)
+	require.Error(t, err)
+	_, err = MapFromLUT3D(m.LUT1D())
+	require.Error(t, err)
+}
+
+func TestHexColor(t *testing.T) {
+	c, err := HexToColor("#22459E")
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{R: 0x22, G: 0x45, B: 0x9e, A: 255}, c)
+	require.Equal(t, "#22459e", ColorToHex(c))
+
+	c, err = HexToColor("#22459e80")
+	require.NoError(t, err)
+	require.Equal(t, color.NRGBA{R: 0x22, G: 0x45, B: 0x9e, A: 0x80}, c)
+	require.Equal(t, "#22459e80", ColorToHex(c))
+
+	for _, padded := range []string{" #22459e", "#22459e ", "\t#22459E\n"} {
+		c, err = HexToColor(padded)
+		require.NoError(t, err, padded)
+		require.Equal(t, color.RGBA{R: 0x22, G: 0x45, B: 0x9e, A: 255}, c)
+	}
+
+	for _, invalid := range []string{"22459e", "#12345678zz", "#1234567", "#12345", "# 22459e", "x#22459e", "#22459e x", "#gg459e", " ", ""} {
+		_, err = HexToColor(invalid)
+		require.Error(t, err, invalid)
+	}
+}
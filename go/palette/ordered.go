@@ -0,0 +1,276 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// ThresholdMap is a matrix of thresholds in [0, 1) which is tiled across an
+// image for ordered dithering.
+type ThresholdMap struct {
+	Width, Height int
+	// Values holds the thresholds in row-major order.
+	Values []float64
+}
+
+// At returns the threshold for the given image coordinates.
+func (m ThresholdMap) At(x, y int) float64 {
+	x %= m.Width
+	if x < 0 {
+		x += m.Width
+	}
+	y %= m.Height
+	if y < 0 {
+		y += m.Height
+	}
+	return m.Values[y*m.Width+x]
+}
+
+// thresholdMapFromRanks creates a ThresholdMap from a matrix containing each
+// of the integers in [0, width*height) exactly once.
+func thresholdMapFromRanks(width, height int, ranks []int) ThresholdMap {
+	n := float64(len(ranks))
+	values := make([]float64, len(ranks))
+	for idx, rank := range ranks {
+		values[idx] = (float64(rank) + 0.5) / n
+	}
+	return ThresholdMap{Width: width, Height: height, Values: values}
+}
+
+// Bayer returns a Bayer matrix of the given size, which must be a power of two
+// between 2 and 16 inclusive.
+func Bayer(size int) (ThresholdMap, error) {
+	if size < 2 || size > 16 || size&(size-1) != 0 {
+		return ThresholdMap{}, fmt.Errorf("invalid Bayer matrix size %d; must be a power of two between 2 and 16", size)
+	}
+	ranks := []int{0}
+	for n := 1; n < size; n *= 2 {
+		next := make([]int, 4*n*n)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				v := 4 * ranks[y*n+x]
+				next[y*2*n+x] = v
+				next[y*2*n+x+n] = v + 2
+				next[(y+n)*2*n+x] = v + 3
+				next[(y+n)*2*n+x+n] = v + 1
+			}
+		}
+		ranks = next
+	}
+	return thresholdMapFromRanks(size, size, ranks), nil
+}
+
+// blueNoiseSize is the width and height of the built-in blue noise map.
+const blueNoiseSize = 64
+
+var (
+	blueNoise     ThresholdMap
+	blueNoiseOnce sync.Once
+)
+
+// BlueNoise returns a built-in blue noise ThresholdMap. It is generated on
+// first use using Ulichney's void-and-cluster method with a fixed seed, so
+// the result is always the same.
+func BlueNoise() ThresholdMap {
+	blueNoiseOnce.Do(func() {
+		blueNoise = voidAndCluster(blueNoiseSize, 1.5, rand.New(rand.NewSource(1)))
+	})
+	return blueNoise
+}
+
+// voidAndCluster generates a blue noise ThresholdMap of the given size using
+// a Gaussian energy filter with the given sigma.
+func voidAndCluster(size int, sigma float64, r *rand.Rand) ThresholdMap {
+	n := size * size
+
+	// Precompute the toroidal Gaussian filter for each offset.
+	filter := make([]float64, n)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			fx := math.Min(float64(dx), float64(size-dx))
+			fy := math.Min(float64(dy), float64(size-dy))
+			filter[dy*size+dx] = math.Exp(-(fx*fx + fy*fy) / (2 * sigma * sigma))
+		}
+	}
+
+	// energy holds the filtered sum of the "on" pixels at each position.
+	pattern := make([]bool, n)
+	energy := make([]float64, n)
+	update := func(idx int, on bool) {
+		pattern[idx] = on
+		sign := 1.0
+		if !on {
+			sign = -1.0
+		}
+		px, py := idx%size, idx/size
+		for y := 0; y < size; y++ {
+			dy := (y - py + size) % size
+			for x := 0; x < size; x++ {
+				dx := (x - px + size) % size
+				energy[y*size+x] += sign * filter[dy*size+dx]
+			}
+		}
+	}
+	// extreme returns the "on" pixel with the highest energy (the tightest
+	// cluster) or the "off" pixel with the lowest energy (the largest void).
+	extreme := func(on bool) int {
+		best := -1
+		for idx, v := range pattern {
+			if v != on {
+				continue
+			}
+			if best < 0 || (on && energy[idx] > energy[best]) || (!on && energy[idx] < energy[best]) {
+				best = idx
+			}
+		}
+		return best
+	}
+
+	// Start with a random pattern of ~10% "on" pixels, then move pixels from
+	// the tightest clusters to the largest voids until it is evenly
+	// distributed.
+	initial := n / 10
+	for _, idx := range r.Perm(n)[:initial] {
+		update(idx, true)
+	}
+	for {
+		cluster := extreme(true)
+		update(cluster, false)
+		void := extreme(false)
+		update(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	prototype := make([]bool, n)
+	copy(prototype, pattern)
+	prototypeEnergy := make([]float64, n)
+	copy(prototypeEnergy, energy)
+
+	ranks := make([]int, n)
+	// Rank the initial pixels by repeatedly removing the tightest cluster.
+	for rank := initial - 1; rank >= 0; rank-- {
+		cluster := extreme(true)
+		update(cluster, false)
+		ranks[cluster] = rank
+	}
+	// Rank the remaining pixels by repeatedly filling the largest void.
+	copy(pattern, prototype)
+	copy(energy, prototypeEnergy)
+	for rank := initial; rank < n; rank++ {
+		void := extreme(false)
+		update(void, true)
+		ranks[void] = rank
+	}
+	return thresholdMapFromRanks(size, size, ranks)
+}
+
+// ThresholdMapFromImage creates a ThresholdMap from the luminance of the given
+// image, eg. a blue noise texture.
+func ThresholdMapFromImage(img image.Image) (ThresholdMap, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return ThresholdMap{}, fmt.Errorf("threshold map image is empty")
+	}
+	values := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g := color.Gray16Model.Convert(img.At(x, y)).(color.Gray16)
+			values = append(values, (float64(g.Y)+0.5)/(math.MaxUint16+1))
+		}
+	}
+	return ThresholdMap{Width: bounds.Dx(), Height: bounds.Dy(), Values: values}, nil
+}
+
+// DecodeThresholdMap decodes an image, eg. a PNG, and creates a ThresholdMap
+// from it. The caller must import the package for the image format.
+func DecodeThresholdMap(r io.Reader) (ThresholdMap, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return ThresholdMap{}, fmt.Errorf("failed to decode threshold map: %w", err)
+	}
+	return ThresholdMapFromImage(img)
+}
+
+// Ordered is a Ditherer which offsets each pixel according to its position in
+// a tiled ThresholdMap before mapping it to the nearest palette color. Unlike
+// error diffusion, the result for each pixel depends only on its own color
+// and position, so it is stable across animation frames and tile edges.
+type Ordered struct {
+	Map ThresholdMap
+	// Strength scales the offsets applied to each pixel. At 1.0, the offsets
+	// span the typical distance between neighboring palette colors.
+	Strength float64
+}
+
+// Dither implements Ditherer.
+func (d Ordered) Dither(src image.Image, p color.Palette) *image.Paletted {
+	bounds := src.Bounds()
+	rv := image.NewPaletted(bounds, p)
+	if len(p) == 0 {
+		return rv
+	}
+	paletteRGB := paletteChannels(p)
+	spread := d.Strength * paletteSpread(paletteRGB)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := src.At(x, y).RGBA()
+			offset := (d.Map.At(x-bounds.Min.X, y-bounds.Min.Y) - 0.5) * spread
+			idx := nearestIndex(paletteRGB,
+				clampChannel(float64(r)+offset),
+				clampChannel(float64(g)+offset),
+				clampChannel(float64(b)+offset))
+			rv.SetColorIndex(x, y, uint8(idx))
+		}
+	}
+	return rv
+}
+
+// paletteSpread estimates the distance between neighboring colors in the
+// palette, as the mean distance from each color to its nearest neighbor. The
+// result is limited to the range of a single 16-bit channel.
+func paletteSpread(paletteRGB [][3]float64) float64 {
+	if len(paletteRGB) < 2 {
+		return 0
+	}
+	total := 0.0
+	for i, a := range paletteRGB {
+		nearest := math.Inf(1)
+		for j, b := range paletteRGB {
+			if i == j {
+				continue
+			}
+			dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+			nearest = math.Min(nearest, math.Sqrt(dr*dr+dg*dg+db*db))
+		}
+		total += nearest
+	}
+	return math.Min(total/float64(len(paletteRGB)), math.MaxUint16)
+}
+
+func init() {
+	for _, size := range []int{2, 4, 8, 16} {
+		size := size
+		ditherers[fmt.Sprintf("bayer%d", size)] = func(opts DitherOptions) (Ditherer, error) {
+			m, err := Bayer(size)
+			if err != nil {
+				return nil, err
+			}
+			return Ordered{Map: m, Strength: opts.Strength}, nil
+		}
+	}
+	ditherers["blue-noise"] = func(opts DitherOptions) (Ditherer, error) {
+		return Ordered{Map: BlueNoise(), Strength: opts.Strength}, nil
+	}
+	ditherers["threshold-map"] = func(opts DitherOptions) (Ditherer, error) {
+		if opts.ThresholdMap == nil {
+			return nil, fmt.Errorf("dithering mode \"threshold-map\" requires a threshold map")
+		}
+		return Ordered{Map: *opts.ThresholdMap, Strength: opts.Strength}, nil
+	}
+}
@@ -0,0 +1,76 @@
+package palette
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBayer(t *testing.T) {
+	m, err := Bayer(2)
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.125, 0.625, 0.875, 0.375}, m.Values)
+
+	for _, size := range []int{2, 4, 8, 16} {
+		m, err := Bayer(size)
+		require.NoError(t, err)
+		requireUniformThresholds(t, m)
+	}
+	for _, size := range []int{0, 1, 3, 32} {
+		_, err := Bayer(size)
+		require.Error(t, err)
+	}
+}
+
+func TestBlueNoise(t *testing.T) {
+	m := BlueNoise()
+	require.Equal(t, blueNoiseSize, m.Width)
+	requireUniformThresholds(t, m)
+	require.Equal(t, m, BlueNoise())
+}
+
+// requireUniformThresholds asserts that the ThresholdMap contains each of the
+// evenly spaced thresholds exactly once.
+func requireUniformThresholds(t *testing.T, m ThresholdMap) {
+	require.Len(t, m.Values, m.Width*m.Height)
+	sorted := append([]float64{}, m.Values...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	for idx, v := range sorted {
+		require.Equal(t, (float64(idx)+0.5)/n, v)
+	}
+}
+
+func TestDecodeThresholdMap(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{Y: 0})
+	img.SetGray(1, 0, color.Gray{Y: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	m, err := DecodeThresholdMap(&buf)
+	require.NoError(t, err)
+	require.Equal(t, 2, m.Width)
+	require.Equal(t, 1, m.Height)
+	require.InDelta(t, 0, m.At(0, 0), 1e-4)
+	require.InDelta(t, 1, m.At(1, 0), 1e-4)
+	require.Equal(t, m.At(1, 0), m.At(-1, 5))
+}
+
+func TestOrderedLevels(t *testing.T) {
+	// The fraction of white pixels should track the brightness of the source.
+	m, err := Bayer(8)
+	require.NoError(t, err)
+	for level := 0; level < 256; level += 15 {
+		src := image.NewUniform(color.Gray{Y: uint8(level)})
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		draw.Draw(img, img.Rect, src, image.Point{}, draw.Src)
+		actual := Ordered{Map: m, Strength: 1}.Dither(img, blackAndWhite)
+		require.InDelta(t, float64(level)/255, countWhite(actual), 1.0/64, "level %d", level)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/erock2112/kmeans/go/colorspace"
 	"github.com/erock2112/kmeans/go/kmeans"
 )
 
@@ -71,6 +73,29 @@ func Monochrome(from color.Color, steps int) color.Palette {
 	return palette
 }
 
+// Duotone creates a color.Palette by interpolating between the two given colors
+// in OKLab, using the given number of steps. The first color is usually the
+// darker, so that the result is ordered from dark to light.
+func Duotone(from, to color.Color, steps int) color.Palette {
+	if steps == 0 {
+		return []color.Color{}
+	} else if steps == 1 {
+		return []color.Color{color.RGBAModel.Convert(from)}
+	}
+	a, b := colorspace.ToOKLab(from), colorspace.ToOKLab(to)
+	palette := make([]color.Color, 0, steps)
+	for i := 0; i < steps; i++ {
+		t := float64(i) / float64(steps-1)
+		c := colorspace.OKLab{
+			L: a.L + t*(b.L-a.L),
+			A: a.A + t*(b.A-a.A),
+			B: a.B + t*(b.B-a.B),
+		}
+		palette = append(palette, color.RGBAModel.Convert(c))
+	}
+	return palette
+}
+
 // Subdivide creates a color.Palette by subdividing the three-dimensional RGB
 // space the given number of times in each direction, resulting in a palette
 // with divisions^3 colors.
@@ -104,124 +129,103 @@ func Subdivide(divisions int) color.Palette {
 }
 
 // FromImage creates a color.Palette from the given image.Image with the given
-// number of colors.
-func FromImage(img image.Image, numColors, maxKMeansIterations int) color.Palette {
+// number of colors. Pixels are clustered in the given ColorSpace. An error is
+// returned if the image is empty or numColors is less than one. The palette
+// may contain duplicate colors, eg. if the image has fewer distinct colors than
+// numColors.
+func FromImage(img image.Image, numColors, maxKMeansIterations int, space ColorSpace) (color.Palette, error) {
 	// Read all of the pixels into an array.
 	bounds := img.Bounds()
 	data := make([]kmeans.Point, 0, bounds.Dx()*bounds.Dy())
 	for x := bounds.Min.X; x < bounds.Max.X; x++ {
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			data = append(data, ColorToPoint(img.At(x, y)))
+			data = append(data, space.ToPoint(img.At(x, y)))
 		}
 	}
 
 	// Find the k-means of the pixels and create a color palette.
 	centroids, err := kmeans.KMeans(data, numColors, maxKMeansIterations)
 	if err != nil {
-		panic("colorPaletteFromImage produced inconsistent data")
+		return nil, fmt.Errorf("failed to cluster %d pixels into %d colors: %w", len(data), numColors, err)
 	}
 	var palette color.Palette = make([]color.Color, 0, len(centroids))
 	for _, centroid := range centroids {
-		palette = append(palette, color.RGBA{
-			R: uint8(centroid[0] >> 8),
-			G: uint8(centroid[1] >> 8),
-			B: uint8(centroid[2] >> 8),
-			A: 255,
-		})
+		palette = append(palette, color.RGBAModel.Convert(space.FromPoint(centroid)))
 	}
-	return palette
-}
-
-// Map describes a mapping from one color.Palette to another. This helps to
-// avoid multiple source colors "collapsing" onto a single destination color,
-// which is relevant when using palettes of limited size.
-type Map map[color.Color]color.Color
-
-// Apply returns a new image.Paletted with the palette mapping applied to the
-// given source image.Paletted. If any colors in the source image are not in the
-// Map, an error is returned.
-func (m Map) Apply(src *image.Paletted) (*image.Paletted, error) {
-	bounds := src.Bounds()
-	palette := make([]color.Color, 0, len(m))
-	for _, c := range m {
-		palette = append(palette, c)
-	}
-	rv := image.NewPaletted(bounds.Bounds(), palette)
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			srcColor := src.At(x, y)
-			dstColor, ok := m[srcColor]
-			if !ok {
-				return nil, fmt.Errorf("source palette does not include color %+v", srcColor)
-			}
-			rv.Set(x, y, dstColor)
-		}
-	}
-	return rv, nil
-}
-
-// ComputeError returns the total error (squared Euclidean distance between
-// source and destination colors) of the map.
-func (m Map) ComputeError() int64 {
-	total := int64(0)
-	for src, dst := range m {
-		total += ColorToPoint(src).SqDist(ColorToPoint(dst))
-	}
-	return total
+	return palette, nil
 }
 
 // MapNearestGreedy creates a Map by iteratively choosing the nearest color
 // pairs in src and dst.
-func MapNearestGreedy(src, dst color.Palette) (Map, error) {
+func MapNearestGreedy(src, dst color.Palette) (*Map, error) {
+	return MapNearestGreedyDistance(src, dst, DistanceRGB)
+}
+
+// MapNearestGreedyDistance creates a Map by iteratively choosing the nearest
+// color pairs in src and dst, as measured by the given Distance.
+func MapNearestGreedyDistance(src, dst color.Palette, distance Distance) (*Map, error) {
 	if len(dst) < len(src) {
 		return nil, fmt.Errorf("dst palette has fewer colors than the src, %d vs %d", len(dst), len(src))
 	}
 
-	origMap := make(map[color.Color]bool, len(src))
-	for _, color := range src {
-		origMap[color] = true
-	}
-	newMap := make(map[color.Color]bool, len(dst))
-	for _, color := range dst {
-		newMap[color] = true
-	}
-
-	rv := make(map[color.Color]color.Color, len(src))
-	for {
-		minDist := int64(-1)
-		var chosenOrig color.Color
-		var chosenNew color.Color
-		for origColor := range origMap {
-			for newColor := range newMap {
-				dist := ColorToPoint(origColor).SqDist(ColorToPoint(newColor))
+	// Iterate over the palettes in order, so that ties are broken
+	// deterministically.
+	usedOrig := make([]bool, len(src))
+	usedNew := make([]bool, len(dst))
+	assignment := make([]int, len(src))
+	for remaining := len(src); remaining > 0; remaining-- {
+		minDist := -1.0
+		chosenOrig, chosenNew := -1, -1
+		for origIdx, origColor := range src {
+			if usedOrig[origIdx] {
+				continue
+			}
+			for newIdx, newColor := range dst {
+				if usedNew[newIdx] {
+					continue
+				}
+				dist := distance(origColor, newColor)
 				if minDist < 0 || dist < minDist {
 					minDist = dist
-					chosenOrig = origColor
-					chosenNew = newColor
+					chosenOrig = origIdx
+					chosenNew = newIdx
 				}
 			}
 		}
-		rv[chosenOrig] = chosenNew
-		delete(origMap, chosenOrig)
-		delete(newMap, chosenNew)
-		if len(origMap) == 0 {
-			break
-		}
+		assignment[chosenOrig] = chosenNew
+		usedOrig[chosenOrig] = true
+		usedNew[chosenNew] = true
 	}
-	return rv, nil
+	return mapFromAssignment(src, dst, assignment), nil
+}
+
+// mapFromAssignment creates a Map from src to dst in which each src[i] maps to
+// dst[assignment[i]]. The destination palette is ordered as dst.
+func mapFromAssignment(src, dst color.Palette, assignment []int) *Map {
+	rv := NewMapWithPalette(dst)
+	for i, j := range assignment {
+		rv.Set(src[i], dst[j])
+	}
+	return rv
 }
 
 // MapNearestBruteForce creates a Map by choosing all combinations of src and
 // dst color pairs and returning the one with the least total error. Will be
 // extremely slow for large palettes, particularly if src and dst have different
 // sizes.
-func MapNearestBruteForce(src, dst color.Palette) (Map, error) {
+func MapNearestBruteForce(src, dst color.Palette) (*Map, error) {
+	return MapNearestBruteForceDistance(src, dst, DistanceRGB)
+}
+
+// MapNearestBruteForceDistance is like MapNearestBruteForce, but measures the
+// total error using the given Distance.
+func MapNearestBruteForceDistance(src, dst color.Palette, distance Distance) (*Map, error) {
 	if len(dst) < len(src) {
 		return nil, fmt.Errorf("dst palette has fewer colors than the src, %d vs %d", len(dst), len(src))
 	}
 
-	bestError := int64(-1)
-	var bestMap Map
+	bestError := -1.0
+	var bestMap *Map
 
 	// Choose subsets of the destination palette.
 	for _, subsetIndexes := range NChooseK(len(dst), len(src)) {
@@ -230,11 +234,12 @@ func MapNearestBruteForce(src, dst color.Palette) (Map, error) {
 			if len(subsetIndexes) != len(permuteIndexes) {
 				return nil, fmt.Errorf("internal error; got mismatched number of subset indexes %v and permutation indexes %v", subsetIndexes, permuteIndexes)
 			}
-			var m Map = make(map[color.Color]color.Color, len(src))
+			assignment := make([]int, len(src))
 			for i := 0; i < len(permuteIndexes); i++ {
-				m[src[permuteIndexes[i]]] = dst[subsetIndexes[i]]
+				assignment[permuteIndexes[i]] = subsetIndexes[i]
 			}
-			totalError := m.ComputeError()
+			m := mapFromAssignment(src, dst, assignment)
+			totalError := m.ComputeErrorDistance(distance)
 			if bestError < 0 || totalError < bestError {
 				bestError = totalError
 				bestMap = m
@@ -287,19 +292,19 @@ func (p ColorPaletteByLuminosity) Swap(i, j int) {
 // MapByLuminosity maps the source palette to the destination by first finding
 // the luminosity of each color and sorting. The source and destination palettes
 // must be the same size.
-func MapByLuminosity(src, dst color.Palette) (Map, error) {
+func MapByLuminosity(src, dst color.Palette) (*Map, error) {
 	return MapDirect(SortedByLuminosity(src), SortedByLuminosity(dst))
 }
 
 // MapDirect maps the source palette directly to the destination palette without
 // any processing. The source and destination palettes must be the same size.
-func MapDirect(src, dst color.Palette) (Map, error) {
+func MapDirect(src, dst color.Palette) (*Map, error) {
 	if len(src) != len(dst) {
 		return nil, fmt.Errorf("src and dst palettes must be the same size, %d vs %d", len(dst), len(src))
 	}
-	rv := make(map[color.Color]color.Color, len(src))
+	rv := NewMapWithPalette(dst)
 	for idx, srcColor := range src {
-		rv[srcColor] = dst[idx]
+		rv.Set(srcColor, dst[idx])
 	}
 	return rv, nil
 }
@@ -378,13 +383,14 @@ func Greyscale(c color.Color) color.Color {
 	}
 }
 
-var hexParsed = regexp.MustCompile("#([0-9a-f]{2})([0-9a-f]{2})([0-9a-f]{2})")
+var hexParsed = regexp.MustCompile("(?i)^#([0-9a-f]{2})([0-9a-f]{2})([0-9a-f]{2})([0-9a-f]{2})?$")
 
 // HexToColor converts a hexadecimal string of the form "#ffffff" to a
-// color.Color.
+// color.Color. An optional alpha channel may be given, as in "#ffffff80".
+// Surrounding whitespace is ignored.
 func HexToColor(hex string) (color.Color, error) {
-	m := hexParsed.FindStringSubmatch(hex)
-	if len(m) != 4 {
+	m := hexParsed.FindStringSubmatch(strings.TrimSpace(hex))
+	if len(m) != 5 {
 		return color.Black, fmt.Errorf("invalid hex color %q", hex)
 	}
 	r, err := strconv.ParseUint(m[1], 16, 8)
@@ -399,9 +405,29 @@ func HexToColor(hex string) (color.Color, error) {
 	if err != nil {
 		return color.Black, fmt.Errorf("failed parsing %q as hex: %s", m[3], err)
 	}
+	if m[4] != "" {
+		a, err := strconv.ParseUint(m[4], 16, 8)
+		if err != nil {
+			return color.Black, fmt.Errorf("failed parsing %q as hex: %s", m[4], err)
+		}
+		if a != math.MaxUint8 {
+			return color.NRGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: uint8(a)}, nil
+		}
+	}
 	return color.RGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: 255}, nil
 }
 
+// ColorToHex converts a color.Color to a hexadecimal string of the form
+// "#ffffff". If the color is not opaque, the alpha channel is included, as in
+// "#ffffff80".
+func ColorToHex(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == math.MaxUint8 {
+		return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
 // InvertColor returns an inverted version of the given Color.
 func InvertColor(c color.Color) color.Color {
 	r, g, b, a := c.RGBA()
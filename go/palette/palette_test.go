@@ -1,6 +1,8 @@
 package palette
 
 import (
+	"image"
+	"image/color"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -96,3 +98,23 @@ func TestPermute(t *testing.T) {
 		{1, 0, 3, 2},
 	})
 }
+
+func TestDuotone(t *testing.T) {
+	from := color.RGBA{R: 0x1b, G: 0x1b, B: 0x3a, A: 0xff}
+	to := color.RGBA{R: 0xf5, G: 0xc5, B: 0x42, A: 0xff}
+	p := Duotone(from, to, 5)
+	require.Len(t, p, 5)
+	require.Equal(t, from, p[0])
+	require.Equal(t, to, p[4])
+	for idx := 1; idx < len(p); idx++ {
+		require.Greater(t, KeyLightness(p[idx]), KeyLightness(p[idx-1]))
+	}
+	require.Equal(t, color.Palette{from}, Duotone(from, to, 1))
+	require.Empty(t, Duotone(from, to, 0))
+}
+
+func TestFromImageError(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 0, 0))
+	_, err := FromImage(img, 4, 100, RGB)
+	require.EqualError(t, err, "failed to cluster 0 pixels into 4 colors: provided data is empty")
+}
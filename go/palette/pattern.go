@@ -0,0 +1,101 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Pattern is a Ditherer which implements Thomas Knoll's pattern dithering, as
+// described by Joel Yliluoma. For each distinct source color, it builds a set
+// of palette colors whose average approximates that color, sorts them by
+// luminance, and then chooses among them using a Bayer matrix. This produces
+// the regular, tile-friendly patterns of ordered dithering while mixing
+// colors accurately with arbitrary palettes.
+type Pattern struct {
+	// Size is the size of the Bayer matrix, which must be a power of two
+	// between 2 and 16. The number of candidate colors for each pixel is
+	// Size^2.
+	Size int
+	// Strength scales the error carried between candidate colors; 1.0 gives
+	// the most accurate mixtures.
+	Strength float64
+}
+
+// Dither implements Ditherer.
+func (d Pattern) Dither(src image.Image, p color.Palette) *image.Paletted {
+	bounds := src.Bounds()
+	rv := image.NewPaletted(bounds, p)
+	if len(p) == 0 {
+		return rv
+	}
+	m, err := Bayer(d.Size)
+	if err != nil {
+		// Dither has no way to report an error, so fall back to the default
+		// size.
+		m, _ = Bayer(8)
+	}
+	paletteRGB := paletteChannels(p)
+	luminance := make([]float64, len(p))
+	for idx, c := range paletteRGB {
+		luminance[idx] = 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+	}
+	numCandidates := len(m.Values)
+
+	// Images with few colors are common for this type of dithering, so cache
+	// the candidates for each distinct color.
+	cache := map[color.RGBA64][]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := src.At(x, y).RGBA()
+			key := color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b)}
+			candidates, ok := cache[key]
+			if !ok {
+				candidates = patternCandidates(paletteRGB, luminance, float64(r), float64(g), float64(b), numCandidates, d.Strength)
+				cache[key] = candidates
+			}
+			// Threshold values are (rank + 0.5) / n, so this recovers the rank.
+			rank := int(m.At(x-bounds.Min.X, y-bounds.Min.Y) * float64(numCandidates))
+			rv.SetColorIndex(x, y, uint8(candidates[rank]))
+		}
+	}
+	return rv
+}
+
+// patternCandidates returns a list of palette indexes whose average
+// approximates the given color, sorted by luminance.
+func patternCandidates(paletteRGB [][3]float64, luminance []float64, r, g, b float64, n int, strength float64) []int {
+	rv := make([]int, 0, n)
+	var errR, errG, errB float64
+	for i := 0; i < n; i++ {
+		idx := nearestIndex(paletteRGB,
+			clampChannel(r+errR*strength),
+			clampChannel(g+errG*strength),
+			clampChannel(b+errB*strength))
+		rv = append(rv, idx)
+		errR += r - paletteRGB[idx][0]
+		errG += g - paletteRGB[idx][1]
+		errB += b - paletteRGB[idx][2]
+	}
+	sort.SliceStable(rv, func(i, j int) bool {
+		return luminance[rv[i]] < luminance[rv[j]]
+	})
+	return rv
+}
+
+func init() {
+	ditherers["riemersma"] = func(opts DitherOptions) (Ditherer, error) {
+		return Riemersma{
+			History:  riemersmaHistory,
+			Ratio:    riemersmaRatio,
+			Strength: opts.Strength,
+		}, nil
+	}
+	for _, size := range []int{4, 8} {
+		size := size
+		ditherers[fmt.Sprintf("pattern%d", size)] = func(opts DitherOptions) (Ditherer, error) {
+			return Pattern{Size: size, Strength: opts.Strength}, nil
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternLevels(t *testing.T) {
+	requireDitherLevels(t, Pattern{Size: 8, Strength: 1})
+}
+
+func TestPatternIsPeriodic(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{R: 90, G: 160, B: 30, A: 255}), image.Point{}, draw.Src)
+	actual := Pattern{Size: 4, Strength: 1}.Dither(img, Subdivide(3))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			require.Equal(t, actual.ColorIndexAt(x%4, y%4), actual.ColorIndexAt(x, y))
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+)
+
+// Weights expresses each pixel of an image as a weighted blend of the colors in
+// a palette, for palette-based recoloring in the spirit of Chang et al., 2015,
+// "Palette-based Photo Recoloring". Unlike Map.Apply, which replaces each pixel
+// with a single palette color, recoloring via Weights moves every pixel by a
+// blend of the changes to nearby palette colors, so that the result keeps the
+// full tonal range of the original image.
+type Weights struct {
+	palette color.Palette
+	bounds  image.Rectangle
+
+	// colors holds the OKLab value of each distinct color in the image, and
+	// weights holds len(palette) weights for each of them, summing to one.
+	colors  []colorspace.OKLab
+	weights []float64
+
+	// pixels holds the index into colors of each pixel, in row-major order,
+	// and alpha holds the alpha of each pixel.
+	pixels []int
+	alpha  []uint16
+}
+
+// ExtractWeights computes the Weights of each pixel of the image with respect
+// to the given palette, which is typically extracted from the image itself,
+// eg. using FromImage. As in Chang et al., weights are computed by radial
+// basis function interpolation, using a Gaussian of the OKLab distance between
+// each pixel and each palette color with the given sigma, so that each palette
+// color has a weight of one for itself. If sigma is zero, the mean distance
+// between palette colors is used. Duplicate palette colors, which k-means may
+// produce, share equally the weight of a single color.
+func ExtractWeights(img image.Image, p color.Palette, sigma float64) (*Weights, error) {
+	if len(p) == 0 {
+		return nil, fmt.Errorf("palette is empty")
+	}
+	if sigma < 0 {
+		return nil, fmt.Errorf("invalid sigma %f", sigma)
+	}
+	// Duplicate colors would make the interpolation singular, so only
+	// distinct colors are interpolated, and owners holds the indexes into p of
+	// each.
+	var paletteLab []colorspace.OKLab
+	var owners [][]int
+	distinct := map[color.RGBA64]int{}
+	for idx, c := range p {
+		key := Key(c)
+		d, ok := distinct[key]
+		if !ok {
+			d = len(paletteLab)
+			distinct[key] = d
+			paletteLab = append(paletteLab, colorspace.ToOKLab(c))
+			owners = append(owners, nil)
+		}
+		owners[d] = append(owners[d], idx)
+	}
+	if sigma == 0 {
+		sigma = meanOKLabDistance(paletteLab)
+	}
+	if sigma == 0 {
+		// There is only one distinct palette color, so any value will do.
+		sigma = 1
+	}
+	coeffs, err := rbfInterpolation(paletteLab, sigma)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	w := &Weights{
+		palette: append(color.Palette{}, p...),
+		bounds:  bounds,
+		pixels:  make([]int, 0, bounds.Dx()*bounds.Dy()),
+		alpha:   make([]uint16, 0, bounds.Dx()*bounds.Dy()),
+	}
+	// Photos contain many repeated colors, so compute weights once for each.
+	colorIndex := map[color.RGBA64]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			opaque := color.RGBA64{R: c.R, G: c.G, B: c.B, A: 0xffff}
+			idx, ok := colorIndex[opaque]
+			if !ok {
+				idx = len(w.colors)
+				colorIndex[opaque] = idx
+				lab := colorspace.ToOKLab(opaque)
+				w.colors = append(w.colors, lab)
+				weights := make([]float64, len(p))
+				for d, weight := range rbfWeights(lab, paletteLab, coeffs, sigma) {
+					for _, owner := range owners[d] {
+						weights[owner] = weight / float64(len(owners[d]))
+					}
+				}
+				w.weights = append(w.weights, weights...)
+			}
+			w.pixels = append(w.pixels, idx)
+			w.alpha = append(w.alpha, c.A)
+		}
+	}
+	return w, nil
+}
+
+// meanOKLabDistance returns the mean distance between each pair of colors.
+func meanOKLabDistance(colors []colorspace.OKLab) float64 {
+	total, count := 0.0, 0
+	for i := range colors {
+		for j := i + 1; j < len(colors); j++ {
+			total += colorspace.DeltaEOK(colors[i], colors[j])
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// rbfInterpolation returns the coefficients of the radial basis function
+// interpolant whose weight for each palette color is one at that color and zero
+// at every other palette color, ie. the inverse of the matrix of Gaussian
+// kernel values between palette colors.
+func rbfInterpolation(p []colorspace.OKLab, sigma float64) ([][]float64, error) {
+	n := len(p)
+	// Gauss-Jordan elimination on [phi | I].
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = make([]float64, 2*n)
+		for j := range p {
+			rows[i][j] = gaussian(colorspace.DeltaEOK(p[i], p[j]), sigma)
+		}
+		rows[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(rows[row][col]) > math.Abs(rows[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(rows[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("palette colors are too similar to separate; try a smaller sigma")
+		}
+		rows[col], rows[pivot] = rows[pivot], rows[col]
+		scale := rows[col][col]
+		for j := range rows[col] {
+			rows[col][j] /= scale
+		}
+		for row := range rows {
+			if row == col || rows[row][col] == 0 {
+				continue
+			}
+			factor := rows[row][col]
+			for j := range rows[row] {
+				rows[row][j] -= factor * rows[col][j]
+			}
+		}
+	}
+	rv := make([][]float64, n)
+	for i := range rv {
+		rv[i] = rows[i][n:]
+	}
+	return rv, nil
+}
+
+// gaussian returns the Gaussian kernel value for the given distance.
+func gaussian(d, sigma float64) float64 {
+	return math.Exp(-d * d / (2 * sigma * sigma))
+}
+
+// rbfWeights returns the weight of each palette color for the given color,
+// using the coefficients from rbfInterpolation. As in Chang et al., negative
+// weights are clamped to zero and the weights are normalized to sum to one.
+func rbfWeights(c colorspace.OKLab, p []colorspace.OKLab, coeffs [][]float64, sigma float64) []float64 {
+	kernel := make([]float64, len(p))
+	nearest := 0
+	for idx, pc := range p {
+		kernel[idx] = gaussian(colorspace.DeltaEOK(c, pc), sigma)
+		if kernel[idx] > kernel[nearest] {
+			nearest = idx
+		}
+	}
+	rv := make([]float64, len(p))
+	total := 0.0
+	for i := range rv {
+		for j, k := range kernel {
+			rv[i] += coeffs[j][i] * k
+		}
+		if rv[i] < 0 {
+			rv[i] = 0
+		}
+		total += rv[i]
+	}
+	if total < 1e-12 {
+		// The color is so far from every palette color that the weights
+		// are meaningless; attribute it entirely to the nearest.
+		for i := range rv {
+			rv[i] = 0
+		}
+		rv[nearest] = 1
+		return rv
+	}
+	for i := range rv {
+		rv[i] /= total
+	}
+	return rv
+}
+
+// Palette returns the palette from which the Weights were extracted.
+func (w *Weights) Palette() color.Palette {
+	return append(color.Palette{}, w.palette...)
+}
+
+// At returns the weight of each palette color for the pixel at (x, y).
+func (w *Weights) At(x, y int) []float64 {
+	if !(image.Point{X: x, Y: y}.In(w.bounds)) {
+		return nil
+	}
+	idx := w.pixels[(y-w.bounds.Min.Y)*w.bounds.Dx()+(x-w.bounds.Min.X)]
+	n := len(w.palette)
+	return append([]float64{}, w.weights[idx*n:(idx+1)*n]...)
+}
+
+// Recolor returns a new image in which each palette color of the Weights has
+// been replaced with the corresponding color of the given palette, which must
+// have the same length. Each pixel moves by the weighted sum of the changes to
+// the palette colors, in OKLab, so that recoloring with the original palette
+// reproduces the original image. The alpha of each pixel is preserved.
+func (w *Weights) Recolor(p color.Palette) (*image.NRGBA, error) {
+	if len(p) != len(w.palette) {
+		return nil, fmt.Errorf("palette has %d colors; expected %d", len(p), len(w.palette))
+	}
+	n := len(w.palette)
+	deltas := make([]colorspace.OKLab, n)
+	for idx := range p {
+		from, to := colorspace.ToOKLab(w.palette[idx]), colorspace.ToOKLab(p[idx])
+		deltas[idx] = colorspace.OKLab{L: to.L - from.L, A: to.A - from.A, B: to.B - from.B}
+	}
+	recolored := make([]color.NRGBA64, len(w.colors))
+	for idx, c := range w.colors {
+		for j, weight := range w.weights[idx*n : (idx+1)*n] {
+			c.L += weight * deltas[j].L
+			c.A += weight * deltas[j].A
+			c.B += weight * deltas[j].B
+		}
+		recolored[idx] = color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	}
+	rv := image.NewNRGBA(w.bounds)
+	for y := w.bounds.Min.Y; y < w.bounds.Max.Y; y++ {
+		for x := w.bounds.Min.X; x < w.bounds.Max.X; x++ {
+			i := (y-w.bounds.Min.Y)*w.bounds.Dx() + (x - w.bounds.Min.X)
+			c := recolored[w.pixels[i]]
+			c.A = w.alpha[i]
+			rv.Set(x, y, c)
+		}
+	}
+	return rv, nil
+}
+
+// Recolor is a convenience function which extracts the Weights of the image
+// with respect to the palette from and recolors it using the palette to.
+func Recolor(img image.Image, from, to color.Palette, sigma float64) (*image.NRGBA, error) {
+	w, err := ExtractWeights(img, from, sigma)
+	if err != nil {
+		return nil, err
+	}
+	return w.Recolor(to)
+}
@@ -0,0 +1,117 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireNear asserts that each channel of the two colors differs by at most
+// one in eight bits.
+func requireNear(t *testing.T, expect, actual color.Color) {
+	e := color.NRGBAModel.Convert(expect).(color.NRGBA)
+	a := color.NRGBAModel.Convert(actual).(color.NRGBA)
+	for _, d := range []int{int(e.R) - int(a.R), int(e.G) - int(a.G), int(e.B) - int(a.B), int(e.A) - int(a.A)} {
+		require.True(t, d >= -1 && d <= 1, "expected %+v but got %+v", e, a)
+	}
+}
+
+func TestRecolorIdentity(t *testing.T) {
+	img := gradientImage(64, 4)
+	img.Set(3, 2, color.NRGBA{R: 200, G: 10, B: 50, A: 128})
+	p := color.Palette{color.Black, color.White, color.RGBA{R: 200, G: 10, B: 50, A: 255}}
+	w, err := ExtractWeights(img, p, 0)
+	require.NoError(t, err)
+	require.Equal(t, p, w.Palette())
+
+	out, err := w.Recolor(p)
+	require.NoError(t, err)
+	require.Equal(t, img.Bounds(), out.Bounds())
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 64; x++ {
+			requireNear(t, img.At(x, y), out.At(x, y))
+		}
+	}
+}
+
+func TestRecolorWeights(t *testing.T) {
+	img := gradientImage(64, 1)
+	p := color.Palette{color.Black, color.White}
+	w, err := ExtractWeights(img, p, 0)
+	require.NoError(t, err)
+	for x := 0; x < 64; x++ {
+		weights := w.At(x, 0)
+		require.Len(t, weights, 2)
+		require.InDelta(t, 1.0, weights[0]+weights[1], 1e-9)
+	}
+	require.Greater(t, w.At(0, 0)[0], 0.5)
+	require.Greater(t, w.At(63, 0)[1], 0.5)
+	require.Nil(t, w.At(64, 0))
+}
+
+func TestRecolorKeepsTonalRange(t *testing.T) {
+	img := gradientImage(256, 1)
+	from := color.Palette{color.Black, color.White}
+	to := color.Palette{color.RGBA{B: 80, A: 255}, color.RGBA{R: 255, G: 255, B: 200, A: 255}}
+	out, err := Recolor(img, from, to, 0)
+	require.NoError(t, err)
+
+	// The endpoints move to the new palette colors.
+	requireNear(t, to[0], out.At(0, 0))
+	requireNear(t, to[1], out.At(255, 0))
+
+	// Unlike a hard mapping, the result is a smooth gradient with many
+	// distinct colors.
+	distinct := map[color.Color]bool{}
+	for x := 0; x < 256; x++ {
+		distinct[out.At(x, 0)] = true
+	}
+	require.Greater(t, len(distinct), 100)
+	m, err := MapDirect(from, to)
+	require.NoError(t, err)
+	hard, err := m.ApplyImage(img, FallbackNearestSource)
+	require.NoError(t, err)
+	distinct = map[color.Color]bool{}
+	for x := 0; x < 256; x++ {
+		distinct[hard.At(x, 0)] = true
+	}
+	require.Len(t, distinct, 2)
+}
+
+func TestRecolorDuplicateColors(t *testing.T) {
+	img := gradientImage(64, 1)
+	// k-means may return the same centroid more than once.
+	p := color.Palette{color.Black, color.White, color.Black}
+	w, err := ExtractWeights(img, p, 0)
+	require.NoError(t, err)
+	require.Equal(t, p, w.Palette())
+	weights := w.At(0, 0)
+	require.InDelta(t, weights[0], weights[2], 1e-9)
+	require.InDelta(t, 1.0, weights[0]+weights[1]+weights[2], 1e-9)
+
+	out, err := w.Recolor(p)
+	require.NoError(t, err)
+	for x := 0; x < 64; x++ {
+		requireNear(t, img.At(x, 0), out.At(x, 0))
+	}
+	// Recoloring both duplicates moves the color as far as recoloring one
+	// distinct color would.
+	red := color.RGBA{R: 255, A: 255}
+	out, err = w.Recolor(color.Palette{red, color.White, red})
+	require.NoError(t, err)
+	requireNear(t, red, out.At(0, 0))
+}
+
+func TestRecolorErrors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	_, err := ExtractWeights(img, nil, 0)
+	require.Error(t, err)
+	_, err = ExtractWeights(img, color.Palette{color.Black}, -1)
+	require.Error(t, err)
+	w, err := ExtractWeights(img, color.Palette{color.Black}, 0)
+	require.NoError(t, err)
+	_, err = w.Recolor(color.Palette{color.Black, color.White})
+	require.Error(t, err)
+}
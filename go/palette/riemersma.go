@@ -0,0 +1,177 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Default settings for Riemersma dithering, as in Riemersma's original
+// article.
+const (
+	riemersmaHistory = 16
+	riemersmaRatio   = 16
+)
+
+// Riemersma is a Ditherer which visits the pixels of an image along a
+// generalized Hilbert curve and diffuses the quantization error of the most
+// recent pixels into the current one, with exponentially decaying weights.
+// Because the curve changes direction constantly, it avoids the directional
+// "worm" artifacts produced by raster-order error diffusion.
+type Riemersma struct {
+	// History is the number of previous errors to remember.
+	History int
+	// Ratio is the ratio between the weights of the newest and oldest
+	// errors in the history.
+	Ratio float64
+	// Strength scales the amount of error which is diffused.
+	Strength float64
+}
+
+// Dither implements Ditherer.
+func (d Riemersma) Dither(src image.Image, p color.Palette) *image.Paletted {
+	bounds := src.Bounds()
+	rv := image.NewPaletted(bounds, p)
+	if len(p) == 0 || bounds.Empty() {
+		return rv
+	}
+	history := d.History
+	if history < 2 {
+		history = riemersmaHistory
+	}
+	ratio := d.Ratio
+	if ratio <= 1 {
+		ratio = riemersmaRatio
+	}
+
+	// weights[0] applies to the oldest error and weights[history-1] to the
+	// newest. They are normalized so that the error of each pixel is
+	// distributed in full over the following pixels.
+	weights := make([]float64, history)
+	weightSum := 0.0
+	for i := range weights {
+		weights[i] = math.Pow(ratio, float64(i)/float64(history-1))
+		weightSum += weights[i]
+	}
+	scale := d.Strength / weightSum
+
+	paletteRGB := paletteChannels(p)
+	// errors is a ring buffer; next is the position of the oldest entry.
+	errors := make([][3]float64, history)
+	next := 0
+
+	gilbertCurve(bounds.Dx(), bounds.Dy(), func(x, y int) {
+		r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+		var acc [3]float64
+		for j := 0; j < history; j++ {
+			e := errors[(next+j)%history]
+			w := weights[j]
+			acc[0] += e[0] * w
+			acc[1] += e[1] * w
+			acc[2] += e[2] * w
+		}
+		want := [3]float64{
+			clampChannel(float64(r) + acc[0]*scale),
+			clampChannel(float64(g) + acc[1]*scale),
+			clampChannel(float64(b) + acc[2]*scale),
+		}
+		idx := nearestIndex(paletteRGB, want[0], want[1], want[2])
+		rv.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(idx))
+
+		// Replace the oldest error with the error of this pixel.
+		errors[next] = [3]float64{
+			want[0] - paletteRGB[idx][0],
+			want[1] - paletteRGB[idx][1],
+			want[2] - paletteRGB[idx][2],
+		}
+		next = (next + 1) % history
+	})
+	return rv
+}
+
+// gilbertCurve calls visit for every point of a width by height rectangle in
+// the order of a generalized Hilbert curve, which fills rectangles of any size.
+// Each point is adjacent to the last, except for a single diagonal step in
+// some rectangles with odd sides.
+func gilbertCurve(width, height int, visit func(x, y int)) {
+	if width <= 0 || height <= 0 {
+		return
+	}
+	if width >= height {
+		gilbert(0, 0, width, 0, 0, height, visit)
+	} else {
+		gilbert(0, 0, 0, height, width, 0, visit)
+	}
+}
+
+// gilbert fills the rectangle with corner (x, y), major axis (ax, ay) and minor
+// axis (bx, by), splitting it into two or three smaller rectangles unless it
+// is a single row or column.
+func gilbert(x, y, ax, ay, bx, by int, visit func(x, y int)) {
+	w, h := abs(ax+ay), abs(bx+by)
+	dax, day := sign(ax), sign(ay)
+	dbx, dby := sign(bx), sign(by)
+	if h == 1 {
+		for i := 0; i < w; i++ {
+			visit(x, y)
+			x, y = x+dax, y+day
+		}
+		return
+	}
+	if w == 1 {
+		for i := 0; i < h; i++ {
+			visit(x, y)
+			x, y = x+dbx, y+dby
+		}
+		return
+	}
+	ax2, ay2 := floorHalf(ax), floorHalf(ay)
+	bx2, by2 := floorHalf(bx), floorHalf(by)
+	w2, h2 := abs(ax2+ay2), abs(bx2+by2)
+	if 2*w > 3*h {
+		// Split a long rectangle in two along its major axis, preferring
+		// halves of even length.
+		if w2%2 == 1 && w > 2 {
+			ax2, ay2 = ax2+dax, ay2+day
+		}
+		gilbert(x, y, ax2, ay2, bx, by, visit)
+		gilbert(x+ax2, y+ay2, ax-ax2, ay-ay2, bx, by, visit)
+		return
+	}
+	// Otherwise go up the first half of the minor axis, along the major axis
+	// and back down.
+	if h2%2 == 1 && h > 2 {
+		bx2, by2 = bx2+dbx, by2+dby
+	}
+	gilbert(x, y, bx2, by2, ax2, ay2, visit)
+	gilbert(x+bx2, y+by2, ax, ay, bx-bx2, by-by2, visit)
+	gilbert(x+(ax-dax)+(bx2-dbx), y+(ay-day)+(by2-dby), -bx2, -by2, -(ax - ax2), -(ay - ay2), visit)
+}
+
+// floorHalf returns v/2 rounded towards negative infinity.
+func floorHalf(v int) int {
+	if v < 0 {
+		return -((1 - v) / 2)
+	}
+	return v / 2
+}
+
+// sign returns -1, 0 or 1 according to the sign of v.
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// abs returns the absolute value of v.
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
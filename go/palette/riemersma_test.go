@@ -0,0 +1,63 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGilbertCurve(t *testing.T) {
+	for _, size := range []image.Point{
+		{1, 1}, {2, 2}, {4, 4}, {16, 16},
+		{1, 7}, {7, 1}, {2, 5}, {5, 2}, {3, 3}, {37, 29}, {29, 37},
+		{4000, 2}, {2, 4000}, {100, 3}, {64, 48},
+	} {
+		seen := map[image.Point]bool{}
+		diagonal := 0
+		var prev image.Point
+		gilbertCurve(size.X, size.Y, func(x, y int) {
+			pt := image.Pt(x, y)
+			require.True(t, pt.In(image.Rectangle{Max: size}), "%v outside %v", pt, size)
+			require.False(t, seen[pt], "visited %v twice in %v", pt, size)
+			if len(seen) > 0 {
+				// Each step moves to an adjacent pixel, or rarely to a
+				// diagonal neighbor.
+				dx, dy := abs(x-prev.X), abs(y-prev.Y)
+				require.True(t, dx <= 1 && dy <= 1 && dx+dy > 0, "step from %v to %v in %v", prev, pt, size)
+				if dx+dy == 2 {
+					diagonal++
+				}
+			}
+			seen[pt] = true
+			prev = pt
+		})
+		require.Len(t, seen, size.X*size.Y, "%v", size)
+		require.LessOrEqual(t, diagonal, 1, "%v", size)
+		if size.X%2 == 0 && size.Y%2 == 0 {
+			require.Zero(t, diagonal, "%v", size)
+		}
+	}
+	gilbertCurve(0, 5, func(x, y int) {
+		t.Fatalf("visited %d,%d of an empty rectangle", x, y)
+	})
+}
+
+func TestRiemersmaLevels(t *testing.T) {
+	requireDitherLevels(t, Riemersma{History: 16, Ratio: 16, Strength: 1})
+}
+
+func TestRiemersmaBounds(t *testing.T) {
+	// A long, thin image with a non-zero origin is filled completely.
+	img := image.NewRGBA(image.Rect(-3, 5, 997, 7))
+	for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+		img.Set(x, 5, color.White)
+	}
+	actual := Riemersma{Strength: 1}.Dither(img, blackAndWhite)
+	require.Equal(t, img.Rect, actual.Rect)
+	for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+		require.Equal(t, uint8(1), actual.ColorIndexAt(x, 5))
+		require.Equal(t, uint8(0), actual.ColorIndexAt(x, 6))
+	}
+}
@@ -0,0 +1,285 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+)
+
+// SortKey returns a value by which colors may be ordered. The SortKeys in this
+// package return values in roughly [0, 1], so that they may be combined using
+// KeyWeighted.
+type SortKey func(c color.Color) float64
+
+// maxOKLCHChroma is approximately the largest OKLCH chroma of any sRGB color.
+const maxOKLCHChroma = 0.33
+
+// achromaticChroma is the OKLCH chroma below which a color is considered grey.
+const achromaticChroma = 1e-4
+
+// KeyLuminosity orders colors by Luminosity.
+func KeyLuminosity(c color.Color) float64 {
+	return float64(Luminosity(c)) / math.MaxUint8
+}
+
+// KeyLightness orders colors by OKLab lightness, which is a much better
+// predictor of perceived lightness than Luminosity.
+func KeyLightness(c color.Color) float64 {
+	return colorspace.ToOKLab(c).L
+}
+
+// KeyChroma orders colors by OKLCH chroma, ie. colorfulness.
+func KeyChroma(c color.Color) float64 {
+	return colorspace.ToOKLab(c).LCH().C / maxOKLCHChroma
+}
+
+// KeyHue returns a SortKey which orders colors by OKLCH hue angle, starting at
+// the given rotation in degrees. Achromatic colors, whose hue is meaningless,
+// sort before all others.
+func KeyHue(rotation float64) SortKey {
+	return func(c color.Color) float64 {
+		lch := colorspace.ToOKLab(c).LCH()
+		if lch.C < achromaticChroma {
+			return 0
+		}
+		h := math.Mod(lch.H-rotation, 360)
+		if h < 0 {
+			h += 360
+		}
+		return h / 360
+	}
+}
+
+// WeightedKey is a SortKey with a weight, for use with KeyWeighted.
+type WeightedKey struct {
+	Key    SortKey
+	Weight float64
+}
+
+// KeyWeighted returns a SortKey which is the weighted sum of the given keys.
+func KeyWeighted(keys ...WeightedKey) SortKey {
+	return func(c color.Color) float64 {
+		total := 0.0
+		for _, k := range keys {
+			total += k.Weight * k.Key(c)
+		}
+		return total
+	}
+}
+
+// SortedBy returns a copy of the palette sorted by the given SortKey. Colors
+// with equal keys retain their relative order.
+func SortedBy(p color.Palette, key SortKey) color.Palette {
+	values := make([]float64, len(p))
+	order := make([]int, len(p))
+	for idx, c := range p {
+		values[idx] = key(c)
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return values[order[i]] < values[order[j]]
+	})
+	rv := make(color.Palette, 0, len(p))
+	for _, idx := range order {
+		rv = append(rv, p[idx])
+	}
+	return rv
+}
+
+// MapBySortKey maps the source palette to the destination by sorting both by
+// the given SortKey and matching colors of equal rank. If the palettes have
+// different sizes, ranks are scaled proportionally, so that several source
+// colors may map to one destination color or some destination colors may be
+// unused. The destination palette of the result is in sorted order.
+func MapBySortKey(src, dst color.Palette, key SortKey) (*Map, error) {
+	if len(src) > 0 && len(dst) == 0 {
+		return nil, fmt.Errorf("dst palette is empty")
+	}
+	sortedSrc := SortedBy(src, key)
+	sortedDst := SortedBy(dst, key)
+	rv := NewMapWithPalette(sortedDst)
+	for idx, c := range sortedSrc {
+		dstIdx := 0
+		if len(sortedSrc) > 1 {
+			dstIdx = int(math.Round(float64(idx) * float64(len(sortedDst)-1) / float64(len(sortedSrc)-1)))
+		}
+		rv.Set(c, sortedDst[dstIdx])
+	}
+	return rv, nil
+}
+
+// MapStrategy creates a Map from one palette to another.
+type MapStrategy func(src, dst color.Palette) (*Map, error)
+
+// sortKeyStrategy returns a MapStrategy which uses MapBySortKey.
+func sortKeyStrategy(key SortKey) MapStrategy {
+	return func(src, dst color.Palette) (*Map, error) {
+		return MapBySortKey(src, dst, key)
+	}
+}
+
+// namedSortKeys are the SortKeys which may be used by name in ParseSortKey.
+var namedSortKeys = map[string]SortKey{
+	"luminosity": KeyLuminosity,
+	"lightness":  KeyLightness,
+	"chroma":     KeyChroma,
+	"hue":        KeyHue(0),
+}
+
+// SortKeyNames lists the sort keys accepted by ParseSortKey.
+var SortKeyNames = []string{"luminosity", "lightness", "hue[:rotation]", "chroma", "weighted:key=weight,..."}
+
+// ParseSortKey returns the SortKey described by the given spec, which is a key
+// name optionally followed by a colon and parameters:
+//
+//   - "luminosity", "lightness" and "chroma" use KeyLuminosity, KeyLightness
+//     and KeyChroma respectively.
+//   - "hue:<degrees>" uses KeyHue with the given rotation, which defaults to
+//     zero.
+//   - "weighted:<key>=<weight>,..." uses KeyWeighted to combine
+//     "luminosity", "lightness", "chroma" and "hue", eg.
+//     "weighted:lightness=1,chroma=0.25".
+func ParseSortKey(spec string) (SortKey, error) {
+	name, params := spec, ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		name, params = spec[:idx], spec[idx+1:]
+	}
+	switch name {
+	case "luminosity", "lightness", "chroma":
+		if params != "" {
+			return nil, fmt.Errorf("sort key %q does not accept parameters", name)
+		}
+		return namedSortKeys[name], nil
+	case "hue":
+		rotation := 0.0
+		if params != "" {
+			var err error
+			rotation, err = strconv.ParseFloat(params, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hue rotation %q: %s", params, err)
+			}
+		}
+		return KeyHue(rotation), nil
+	case "weighted":
+		if params == "" {
+			return nil, fmt.Errorf("sort key \"weighted\" requires weights, eg. \"weighted:lightness=1,chroma=0.25\"")
+		}
+		weights, err := ParseParams(params)
+		if err != nil {
+			return nil, err
+		}
+		// Sum the keys in a fixed order, so that ties are broken the same
+		// way on every run.
+		keyNames := make([]string, 0, len(weights))
+		for keyName := range weights {
+			keyNames = append(keyNames, keyName)
+		}
+		sort.Strings(keyNames)
+		keys := make([]WeightedKey, 0, len(weights))
+		for _, keyName := range keyNames {
+			weightStr := weights[keyName]
+			key, ok := namedSortKeys[keyName]
+			if !ok {
+				return nil, fmt.Errorf("unknown sort key %q", keyName)
+			}
+			weight, err := strconv.ParseFloat(weightStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight %q for %q: %s", weightStr, keyName, err)
+			}
+			keys = append(keys, WeightedKey{Key: key, Weight: weight})
+		}
+		return KeyWeighted(keys...), nil
+	default:
+		return nil, fmt.Errorf("unknown sort key %q; known keys: %s", name, strings.Join(SortKeyNames, ", "))
+	}
+}
+
+// MapStrategyNames lists the strategies accepted by ParseMapStrategy.
+var MapStrategyNames = []string{"luminosity", "lightness", "hue[:rotation]", "chroma", "weighted:key=weight,...", "direct", "greedy", "optimal", "constrained[:ordered,all,max=n,distance=name]"}
+
+// ParseMapStrategy returns the MapStrategy described by the given spec, which
+// is a strategy name optionally followed by a colon and parameters:
+//
+//   - Any sort key accepted by ParseSortKey sorts both palettes by that key
+//     and matches colors of equal rank, eg. "lightness" or "hue:30".
+//   - "direct", "greedy" and "optimal" use MapDirect, MapNearestGreedy and
+//     MapOptimal respectively.
+//   - "constrained" uses MapConstrained, which may map several colors onto
+//     one. Its options are "ordered" to preserve luminosity order, "all" to
+//     use every destination color, "max=n" to map at most n colors onto each
+//     destination color and "distance=name" to select a Distance other than
+//     DistanceRGB, eg. "constrained:ordered,all,distance=oklab".
+func ParseMapStrategy(spec string) (MapStrategy, error) {
+	name, params := spec, ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		name, params = spec[:idx], spec[idx+1:]
+	}
+	noParams := func(s MapStrategy) (MapStrategy, error) {
+		if params != "" {
+			return nil, fmt.Errorf("map strategy %q does not accept parameters", name)
+		}
+		return s, nil
+	}
+	switch name {
+	case "luminosity", "lightness", "chroma", "hue", "weighted":
+		key, err := ParseSortKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		return sortKeyStrategy(key), nil
+	case "direct":
+		return noParams(MapDirect)
+	case "greedy":
+		return noParams(MapNearestGreedy)
+	case "optimal":
+		return noParams(MapOptimal)
+	case "constrained":
+		return parseConstrainedStrategy(params)
+	default:
+		return nil, fmt.Errorf("unknown map strategy %q; known strategies: %s", name, strings.Join(MapStrategyNames, ", "))
+	}
+}
+
+// parseConstrainedStrategy returns a MapStrategy which uses MapConstrained with
+// the constraints and Distance given by the comma-separated options.
+func parseConstrainedStrategy(params string) (MapStrategy, error) {
+	var constraints MapConstraints
+	distance := DistanceRGB
+	if params != "" {
+		for _, option := range strings.Split(params, ",") {
+			option = strings.TrimSpace(option)
+			key, value := option, ""
+			if idx := strings.Index(option, "="); idx >= 0 {
+				key, value = option[:idx], option[idx+1:]
+			}
+			switch {
+			case option == "ordered":
+				constraints.PreserveLuminosityOrder = true
+			case option == "all":
+				constraints.UseAllDestinations = true
+			case key == "max" && value != "":
+				max, err := strconv.Atoi(value)
+				if err != nil || max < 1 {
+					return nil, fmt.Errorf("invalid max %q for map strategy \"constrained\"; expected a positive integer", value)
+				}
+				constraints.MaxPerDestination = max
+			case key == "distance" && value != "":
+				d, err := ParseDistance(value)
+				if err != nil {
+					return nil, err
+				}
+				distance = d
+			default:
+				return nil, fmt.Errorf("unknown option %q for map strategy \"constrained\"; expected ordered, all, max=n or distance=name", option)
+			}
+		}
+	}
+	return func(src, dst color.Palette) (*Map, error) {
+		return MapConstrained(src, dst, constraints, distance)
+	}, nil
+}
@@ -0,0 +1,135 @@
+package palette
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	strategyRed    = color.RGBA{R: 255, A: 255}
+	strategyYellow = color.RGBA{R: 255, G: 255, A: 255}
+	strategyGreen  = color.RGBA{G: 255, A: 255}
+	strategyBlue   = color.RGBA{B: 255, A: 255}
+	strategyGrey   = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+)
+
+func TestSortedBy(t *testing.T) {
+	p := color.Palette{strategyYellow, strategyBlue, strategyGrey, strategyRed}
+	require.Equal(t, color.Palette{strategyBlue, strategyGrey, strategyRed, strategyYellow}, SortedBy(p, KeyLightness))
+	require.Equal(t, color.Palette{strategyGrey, strategyYellow, strategyRed, strategyBlue}, SortedBy(p, KeyChroma))
+	// OKLCH hues: red ~29, yellow ~110, blue ~264. Grey has no hue, so
+	// sorts first.
+	require.Equal(t, color.Palette{strategyGrey, strategyRed, strategyYellow, strategyBlue}, SortedBy(p, KeyHue(0)))
+	require.Equal(t, color.Palette{strategyGrey, strategyYellow, strategyBlue, strategyRed}, SortedBy(p, KeyHue(90)))
+
+	// Equal weights of chroma and inverted lightness.
+	weighted := KeyWeighted(WeightedKey{Key: KeyChroma, Weight: 1}, WeightedKey{Key: KeyLightness, Weight: -1})
+	require.Equal(t, color.Palette{strategyGrey, strategyYellow, strategyRed, strategyBlue}, SortedBy(p, weighted))
+}
+
+func TestMapBySortKey(t *testing.T) {
+	src := color.Palette{strategyYellow, strategyBlue, strategyGrey, strategyRed}
+	dst := Monochrome(strategyGreen, 4)
+	m, err := MapBySortKey(src, dst, KeyLightness)
+	require.NoError(t, err)
+	sortedDst := SortedBy(dst, KeyLightness)
+	require.Equal(t, sortedDst, m.Palette())
+	for idx, c := range SortedBy(src, KeyLightness) {
+		requireMapsTo(t, m, c, sortedDst[idx])
+	}
+
+	// Fewer destination colors: ranks are scaled.
+	m, err = MapBySortKey(src, color.Palette{color.White, color.Black}, KeyLightness)
+	require.NoError(t, err)
+	requireMapsTo(t, m, strategyBlue, color.Black)
+	requireMapsTo(t, m, strategyGrey, color.Black)
+	requireMapsTo(t, m, strategyRed, color.White)
+	requireMapsTo(t, m, strategyYellow, color.White)
+
+	_, err = MapBySortKey(src, nil, KeyLightness)
+	require.Error(t, err)
+}
+
+func TestParseMapStrategy(t *testing.T) {
+	src := color.Palette{strategyYellow, strategyBlue, strategyGrey, strategyRed}
+	dst := Monochrome(strategyGreen, 4)
+	for _, spec := range []string{"luminosity", "lightness", "chroma", "hue", "hue:120.5", "weighted:lightness=1,chroma=0.25,hue=-0.1", "direct", "greedy", "optimal", "constrained", "constrained:ordered,all,max=2,distance=oklab"} {
+		t.Run(spec, func(t *testing.T) {
+			strategy, err := ParseMapStrategy(spec)
+			require.NoError(t, err)
+			m, err := strategy(src, dst)
+			require.NoError(t, err)
+			require.Equal(t, len(src), m.Len())
+		})
+	}
+
+	// The luminosity strategy matches MapByLuminosity.
+	strategy, err := ParseMapStrategy("luminosity")
+	require.NoError(t, err)
+	actual, err := strategy(src, dst)
+	require.NoError(t, err)
+	expect, err := MapByLuminosity(src, dst)
+	require.NoError(t, err)
+	expect.Range(func(src, dst color.Color) {
+		requireMapsTo(t, actual, src, dst)
+	})
+
+	// The constrained strategy matches MapConstrained.
+	strategy, err = ParseMapStrategy("constrained:all,max=1")
+	require.NoError(t, err)
+	actual, err = strategy(src, dst)
+	require.NoError(t, err)
+	expect, err = MapConstrained(src, dst, MapConstraints{MaxPerDestination: 1, UseAllDestinations: true}, DistanceRGB)
+	require.NoError(t, err)
+	expect.Range(func(src, dst color.Color) {
+		requireMapsTo(t, actual, src, dst)
+	})
+	used := map[color.Color]bool{}
+	actual.Range(func(_, dst color.Color) {
+		used[dst] = true
+	})
+	require.Len(t, used, len(dst))
+
+	for _, spec := range []string{"bogus", "hue:abc", "weighted", "weighted:bogus=1", "weighted:chroma=x", "lightness:1", "constrained:bogus", "constrained:max=0", "constrained:max=", "constrained:distance=bogus"} {
+		_, err := ParseMapStrategy(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestParseSortKey(t *testing.T) {
+	p := color.Palette{strategyYellow, strategyBlue, strategyGrey, strategyRed}
+	for spec, expect := range map[string]SortKey{
+		"luminosity": KeyLuminosity,
+		"lightness":  KeyLightness,
+		"chroma":     KeyChroma,
+		"hue":        KeyHue(0),
+		"hue:120.5":  KeyHue(120.5),
+		"weighted:lightness=1,chroma=0.25": KeyWeighted(
+			WeightedKey{Key: KeyLightness, Weight: 1},
+			WeightedKey{Key: KeyChroma, Weight: 0.25},
+		),
+	} {
+		key, err := ParseSortKey(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, SortedBy(p, expect), SortedBy(p, key), spec)
+	}
+	// The weighted sum is computed in the same order on every parse, so that
+	// floating point rounding, and hence tie breaking, does not vary.
+	spec := "weighted:luminosity=0.1,lightness=0.7,chroma=0.3,hue=0.9"
+	first, err := ParseSortKey(spec)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		key, err := ParseSortKey(spec)
+		require.NoError(t, err)
+		for _, c := range p {
+			require.Equal(t, first(c), key(c))
+		}
+	}
+
+	for _, spec := range []string{"bogus", "direct", "hue:abc", "weighted", "weighted:bogus=1", "weighted:chroma=x", "lightness:1"} {
+		_, err := ParseSortKey(spec)
+		require.Error(t, err, spec)
+	}
+}
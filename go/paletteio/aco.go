@@ -0,0 +1,146 @@
+package paletteio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+)
+
+// ACO color space identifiers.
+const (
+	acoRGB  = 0
+	acoHSB  = 1
+	acoCMYK = 2
+	acoLab  = 7
+	acoGray = 8
+)
+
+// acoEntry is the color data of a single swatch in an ACO file.
+type acoEntry struct {
+	Space      uint16
+	W, X, Y, Z uint16
+}
+
+// color converts the entry to a color.Color.
+func (e acoEntry) color() (color.Color, error) {
+	switch e.Space {
+	case acoRGB:
+		return color.RGBA64{R: e.W, G: e.X, B: e.Y, A: 0xffff}, nil
+	case acoHSB:
+		hsv := colorspace.HSV{H: unit(float64(e.W), 0xffff) * 360, S: unit(float64(e.X), 0xffff), V: unit(float64(e.Y), 0xffff)}
+		return color.RGBA64Model.Convert(hsv), nil
+	case acoCMYK:
+		// CMYK channels are stored such that zero means 100% ink.
+		ink := func(v uint16) float64 {
+			return 1 - unit(float64(v), 0xffff)
+		}
+		return cmykToRGB(ink(e.W), ink(e.X), ink(e.Y), ink(e.Z)), nil
+	case acoLab:
+		lab := colorspace.LabD50{L: float64(e.W) / 100, A: float64(int16(e.X)) / 100, B: float64(int16(e.Y)) / 100}
+		return color.RGBA64Model.Convert(lab), nil
+	case acoGray:
+		// Grayscale is stored as ink coverage, where 10000 is black.
+		v := 1 - unit(float64(e.W), 10000)
+		return rgb64(v, v, v), nil
+	default:
+		return nil, fmt.Errorf("unsupported ACO color space %d", e.Space)
+	}
+}
+
+// ReadACO reads a palette in the Adobe Photoshop .aco swatch format. RGB
+// entries are returned as color.RGBA64; HSB, CMYK, Lab and grayscale entries
+// are converted to RGB. Lab entries are relative to the D50 white point, as in
+// Photoshop, and are adapted to the D65 white point of sRGB. Swatch names are
+// read from the version 2 section of the file, if present.
+func ReadACO(r io.Reader) (*Palette, error) {
+	br := bufio.NewReader(r)
+	var rv *Palette
+	for {
+		var header struct {
+			Version, Count uint16
+		}
+		if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+			if errors.Is(err, io.EOF) && rv != nil {
+				return rv, nil
+			}
+			return nil, fmt.Errorf("invalid ACO file: %s", err)
+		}
+		if header.Version != 1 && header.Version != 2 {
+			if rv != nil {
+				// Ignore trailing data after the version 1 section.
+				return rv, nil
+			}
+			return nil, fmt.Errorf("unsupported ACO version %d", header.Version)
+		}
+		section := &Palette{}
+		for idx := 0; idx < int(header.Count); idx++ {
+			var entry acoEntry
+			if err := binary.Read(br, binary.BigEndian, &entry); err != nil {
+				return nil, fmt.Errorf("invalid ACO file: %s", err)
+			}
+			name := ""
+			if header.Version == 2 {
+				var length uint32
+				if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+					return nil, fmt.Errorf("invalid ACO file: %s", err)
+				}
+				var err error
+				if name, err = readUTF16(br, int(length)); err != nil {
+					return nil, fmt.Errorf("invalid ACO file: %s", err)
+				}
+			}
+			c, err := entry.color()
+			if err != nil {
+				return nil, err
+			}
+			section.Add(c, name)
+		}
+		// The version 2 section repeats the colors of version 1, with names,
+		// so prefer it.
+		rv = section
+		if header.Version == 2 {
+			return rv, nil
+		}
+	}
+}
+
+// WriteACO writes the palette in the Adobe Photoshop .aco swatch format, as
+// RGB entries. Both the version 1 section and the version 2 section, which
+// holds swatch names, are written. Alpha is discarded, and the palette name and
+// column count are not stored.
+func WriteACO(w io.Writer, p *Palette) error {
+	if len(p.Colors) > 0xffff {
+		return fmt.Errorf("ACO files may hold at most %d colors", 0xffff)
+	}
+	bw := bufio.NewWriter(w)
+	entries := make([]acoEntry, 0, len(p.Colors))
+	for _, c := range p.Colors {
+		rgba := opaque64(c)
+		entries = append(entries, acoEntry{Space: acoRGB, W: rgba.R, X: rgba.G, Y: rgba.B})
+	}
+	for _, version := range []uint16{1, 2} {
+		if err := binary.Write(bw, binary.BigEndian, []uint16{version, uint16(len(entries))}); err != nil {
+			return err
+		}
+		for idx, entry := range entries {
+			if err := binary.Write(bw, binary.BigEndian, entry); err != nil {
+				return err
+			}
+			if version == 2 {
+				name := utf16Units(p.ColorName(idx))
+				if err := binary.Write(bw, binary.BigEndian, uint32(len(name))); err != nil {
+					return err
+				}
+				if err := binary.Write(bw, binary.BigEndian, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
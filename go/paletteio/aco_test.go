@@ -0,0 +1,126 @@
+package paletteio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bigEndian encodes the given values using binary.Write.
+func bigEndian(t *testing.T, values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		require.NoError(t, binary.Write(&buf, binary.BigEndian, v))
+	}
+	return buf.Bytes()
+}
+
+// requireColorsNear asserts that each color matches the expected color to
+// within one in eight bits per channel.
+func requireColorsNear(t *testing.T, expect, actual color.Palette) {
+	require.Len(t, actual, len(expect))
+	for idx := range expect {
+		e := color.NRGBAModel.Convert(expect[idx]).(color.NRGBA)
+		a := color.NRGBAModel.Convert(actual[idx]).(color.NRGBA)
+		for _, d := range []int{int(e.R) - int(a.R), int(e.G) - int(a.G), int(e.B) - int(a.B), int(e.A) - int(a.A)} {
+			require.True(t, d >= -1 && d <= 1, "color %d: expected %+v but got %+v", idx, e, a)
+		}
+	}
+}
+
+func TestReadACOVersion1(t *testing.T) {
+	data := bigEndian(t,
+		[]uint16{1, 5},
+		[]uint16{acoRGB, 0xffff, 0x8080, 0, 0},
+		// Pure green in HSB.
+		[]uint16{acoHSB, 0xffff / 3, 0xffff, 0xffff, 0},
+		// 100% cyan ink, no black.
+		[]uint16{acoCMYK, 0, 0xffff, 0xffff, 0xffff},
+		// Lab white.
+		[]uint16{acoLab, 10000, 0, 0, 0},
+		// 75% grey ink.
+		[]uint16{acoGray, 7500, 0, 0, 0},
+	)
+	p, err := ReadACO(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Nil(t, p.Names)
+	requireColorsNear(t, color.Palette{
+		color.RGBA{R: 255, G: 128, A: 255},
+		color.RGBA{G: 255, A: 255},
+		color.RGBA{G: 255, B: 255, A: 255},
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		color.RGBA{R: 64, G: 64, B: 64, A: 255},
+	}, p.Colors)
+}
+
+func TestReadACOLabD50(t *testing.T) {
+	// Photoshop stores sRGB red as L=54.29, a=80.81, b=69.89 relative to D50.
+	a, b := int16(8081), int16(6989)
+	data := bigEndian(t, []uint16{1, 1}, []uint16{acoLab, 5429, uint16(a), uint16(b), 0})
+	p, err := ReadACO(bytes.NewReader(data))
+	require.NoError(t, err)
+	requireColorsNear(t, color.Palette{color.RGBA{R: 255, A: 255}}, p.Colors)
+}
+
+func TestReadACONegativeLab(t *testing.T) {
+	// L=50, a=-20, b=30 is an olive green.
+	a, b := int16(-2000), int16(3000)
+	data := bigEndian(t, []uint16{1, 1}, []uint16{acoLab, 5000, uint16(a), uint16(b), 0})
+	p, err := ReadACO(bytes.NewReader(data))
+	require.NoError(t, err)
+	c := color.NRGBAModel.Convert(p.Colors[0]).(color.NRGBA)
+	require.Greater(t, c.G, c.R)
+	require.Greater(t, c.R, c.B)
+}
+
+func TestACORoundTrip(t *testing.T) {
+	p := &Palette{
+		Colors: color.Palette{
+			color.RGBA{R: 1, G: 2, B: 3, A: 255},
+			color.RGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff},
+			color.RGBA{R: 255, A: 255},
+		},
+		Names: []string{"One", "", "Rød 🎨"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteACO(&buf, p))
+	actual, err := ReadACO(&buf)
+	require.NoError(t, err)
+	require.Equal(t, p.Names, actual.Names)
+	require.Len(t, actual.Colors, len(p.Colors))
+	for idx := range p.Colors {
+		require.Equal(t, color.RGBA64Model.Convert(p.Colors[idx]), actual.Colors[idx])
+	}
+
+	// Readers which only understand version 1 see the same colors.
+	buf.Reset()
+	require.NoError(t, WriteACO(&buf, p))
+	v1 := buf.Bytes()[:4+10*len(p.Colors)]
+	actual, err = ReadACO(bytes.NewReader(v1))
+	require.NoError(t, err)
+	require.Nil(t, actual.Names)
+	require.Len(t, actual.Colors, len(p.Colors))
+
+	path := filepath.Join(t.TempDir(), "test.aco")
+	require.NoError(t, WriteFile(path, p))
+	actual, err = ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, p.Names, actual.Names)
+}
+
+func TestReadACOErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":       {},
+		"version":     bigEndian(t, []uint16{3, 0}),
+		"truncated":   bigEndian(t, []uint16{1, 2}, []uint16{acoRGB, 0, 0, 0, 0}),
+		"color space": bigEndian(t, []uint16{1, 1}, []uint16{99, 0, 0, 0, 0}),
+		"name":        bigEndian(t, []uint16{2, 1}, []uint16{acoRGB, 0, 0, 0, 0}, uint32(1<<20)),
+	} {
+		_, err := ReadACO(bytes.NewReader(data))
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,208 @@
+package paletteio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+
+	"github.com/erock2112/kmeans/go/colorspace"
+)
+
+// aseMagic is the signature at the start of every ASE file.
+const aseMagic = "ASEF"
+
+// ASE block types.
+const (
+	aseGroupStart = 0xc001
+	aseGroupEnd   = 0xc002
+	aseColor      = 0x0001
+)
+
+// aseNormalColor is the ASE color type for a normal (ie. not global or spot)
+// color.
+const aseNormalColor = 2
+
+// maxASEBlockLength limits the size of a single block, so that corrupt files
+// do not cause huge allocations.
+const maxASEBlockLength = 1 << 20
+
+// ReadASE reads a palette in the Adobe Swatch Exchange .ase format. RGB
+// entries are returned as color.RGBA64; CMYK, Lab and grayscale entries are
+// converted to RGB. Lab entries are relative to the D50 white point, as in
+// Adobe applications, and are adapted to the D65 white point of sRGB. Colors
+// in all groups are read, in order, and the name of the first group is used as
+// the name of the palette.
+func ReadASE(r io.Reader) (*Palette, error) {
+	br := bufio.NewReader(r)
+	var header struct {
+		Magic        [4]byte
+		Major, Minor uint16
+		Blocks       uint32
+	}
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("invalid ASE file: %s", err)
+	}
+	if string(header.Magic[:]) != aseMagic {
+		return nil, fmt.Errorf("not an ASE file; expected %q signature", aseMagic)
+	}
+	if header.Major != 1 {
+		return nil, fmt.Errorf("unsupported ASE version %d.%d", header.Major, header.Minor)
+	}
+	rv := &Palette{}
+	for idx := uint32(0); idx < header.Blocks; idx++ {
+		var blockHeader struct {
+			Type   uint16
+			Length uint32
+		}
+		if err := binary.Read(br, binary.BigEndian, &blockHeader); err != nil {
+			return nil, fmt.Errorf("invalid ASE file: %s", err)
+		}
+		if blockHeader.Length > maxASEBlockLength {
+			return nil, fmt.Errorf("invalid ASE file: block length %d is too long", blockHeader.Length)
+		}
+		body := make([]byte, blockHeader.Length)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return nil, fmt.Errorf("invalid ASE file: %s", err)
+		}
+		switch blockHeader.Type {
+		case aseGroupStart:
+			name, err := readASEName(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			if rv.Name == "" {
+				rv.Name = name
+			}
+		case aseColor:
+			c, name, err := readASEColor(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			rv.Add(c, name)
+		}
+	}
+	return rv, nil
+}
+
+// readASEName reads a length-prefixed name from an ASE block.
+func readASEName(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", fmt.Errorf("invalid ASE file: %s", err)
+	}
+	name, err := readUTF16(r, int(length))
+	if err != nil {
+		return "", fmt.Errorf("invalid ASE file: %s", err)
+	}
+	return name, nil
+}
+
+// readASEColor reads the body of an ASE color entry block.
+func readASEColor(r io.Reader) (color.Color, string, error) {
+	name, err := readASEName(r)
+	if err != nil {
+		return nil, "", err
+	}
+	var model [4]byte
+	if err := binary.Read(r, binary.BigEndian, &model); err != nil {
+		return nil, "", fmt.Errorf("invalid ASE file: %s", err)
+	}
+	var numValues int
+	switch string(model[:]) {
+	case "RGB ", "LAB ":
+		numValues = 3
+	case "CMYK":
+		numValues = 4
+	case "Gray":
+		numValues = 1
+	default:
+		return nil, "", fmt.Errorf("unsupported ASE color model %q", model)
+	}
+	values := make([]float32, numValues)
+	if err := binary.Read(r, binary.BigEndian, values); err != nil {
+		return nil, "", fmt.Errorf("invalid ASE file: %s", err)
+	}
+	v := func(idx int) float64 {
+		return float64(values[idx])
+	}
+	switch string(model[:]) {
+	case "RGB ":
+		return rgb64(v(0), v(1), v(2)), name, nil
+	case "LAB ":
+		// L is stored as a fraction of 100.
+		lab := colorspace.LabD50{L: v(0) * 100, A: v(1), B: v(2)}
+		return color.RGBA64Model.Convert(lab), name, nil
+	case "CMYK":
+		return cmykToRGB(v(0), v(1), v(2), v(3)), name, nil
+	default:
+		// Gray is stored as a lightness, where 1 is white.
+		return rgb64(v(0), v(0), v(0)), name, nil
+	}
+}
+
+// WriteASE writes the palette in the Adobe Swatch Exchange .ase format, as
+// RGB entries. If the palette has a name, the colors are written within a group
+// of that name. Alpha is discarded, and the column count is not stored.
+func WriteASE(w io.Writer, p *Palette) error {
+	var blocks [][]byte
+	var blockTypes []uint16
+	addBlock := func(blockType uint16, fields ...interface{}) error {
+		var body bytes.Buffer
+		for _, field := range fields {
+			if err := binary.Write(&body, binary.BigEndian, field); err != nil {
+				return err
+			}
+		}
+		blocks = append(blocks, body.Bytes())
+		blockTypes = append(blockTypes, blockType)
+		return nil
+	}
+	nameFields := func(name string) []interface{} {
+		units := utf16Units(name)
+		return []interface{}{uint16(len(units)), units}
+	}
+	if p.Name != "" {
+		if err := addBlock(aseGroupStart, nameFields(p.Name)...); err != nil {
+			return err
+		}
+	}
+	for idx, c := range p.Colors {
+		rgba := opaque64(c)
+		values := []float32{float32(rgba.R) / 0xffff, float32(rgba.G) / 0xffff, float32(rgba.B) / 0xffff}
+		fields := append(nameFields(p.ColorName(idx)), []byte("RGB "), values, uint16(aseNormalColor))
+		if err := addBlock(aseColor, fields...); err != nil {
+			return err
+		}
+	}
+	if p.Name != "" {
+		if err := addBlock(aseGroupEnd); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(aseMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.BigEndian, []uint16{1, 0}); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.BigEndian, uint32(len(blocks))); err != nil {
+		return err
+	}
+	for idx, block := range blocks {
+		if err := binary.Write(bw, binary.BigEndian, blockTypes[idx]); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.BigEndian, uint32(len(block))); err != nil {
+			return err
+		}
+		if _, err := bw.Write(block); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,101 @@
+package paletteio
+
+import (
+	"bytes"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// aseBlock encodes an ASE block with the given type and body.
+func aseBlock(t *testing.T, blockType uint16, body []byte) []byte {
+	return append(bigEndian(t, blockType, uint32(len(body))), body...)
+}
+
+// aseColorBlock encodes an ASE color entry block.
+func aseColorBlock(t *testing.T, name, model string, values ...float32) []byte {
+	units := utf16Units(name)
+	return aseBlock(t, aseColor, bigEndian(t, uint16(len(units)), units, []byte(model), values, uint16(aseNormalColor)))
+}
+
+func TestReadASE(t *testing.T) {
+	groupName := utf16Units("Brand")
+	data := bigEndian(t, []byte(aseMagic), []uint16{1, 0}, uint32(7))
+	data = append(data, aseBlock(t, aseGroupStart, bigEndian(t, uint16(len(groupName)), groupName))...)
+	data = append(data, aseColorBlock(t, "Orange", "RGB ", 1, 0.5, 0)...)
+	data = append(data, aseColorBlock(t, "Cyan", "CMYK", 1, 0, 0, 0)...)
+	data = append(data, aseColorBlock(t, "White", "LAB ", 1, 0, 0)...)
+	data = append(data, aseColorBlock(t, "", "Gray", 0.25)...)
+	data = append(data, aseBlock(t, aseGroupEnd, nil)...)
+	// Unknown block types are skipped.
+	data = append(data, aseBlock(t, 0x1234, []byte{1, 2, 3})...)
+
+	p, err := ReadASE(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, "Brand", p.Name)
+	require.Equal(t, []string{"Orange", "Cyan", "White", ""}, p.Names)
+	requireColorsNear(t, color.Palette{
+		color.RGBA{R: 255, G: 128, A: 255},
+		color.RGBA{G: 255, B: 255, A: 255},
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		color.RGBA{R: 64, G: 64, B: 64, A: 255},
+	}, p.Colors)
+}
+
+func TestReadASELabD50(t *testing.T) {
+	// sRGB red relative to D50, with L stored as a fraction of 100.
+	data := bigEndian(t, []byte(aseMagic), []uint16{1, 0}, uint32(1))
+	data = append(data, aseColorBlock(t, "Red", "LAB ", 0.5429, 80.81, 69.89)...)
+	p, err := ReadASE(bytes.NewReader(data))
+	require.NoError(t, err)
+	requireColorsNear(t, color.Palette{color.RGBA{R: 255, A: 255}}, p.Colors)
+}
+
+func TestASERoundTrip(t *testing.T) {
+	for _, name := range []string{"", "Brand Colors"} {
+		p := &Palette{
+			Name: name,
+			Colors: color.Palette{
+				color.RGBA{R: 1, G: 2, B: 3, A: 255},
+				color.RGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff},
+			},
+			Names: []string{"First", "Second"},
+		}
+		var buf bytes.Buffer
+		require.NoError(t, WriteASE(&buf, p))
+		actual, err := ReadASE(&buf)
+		require.NoError(t, err)
+		require.Equal(t, p.Name, actual.Name)
+		require.Equal(t, p.Names, actual.Names)
+		for idx := range p.Colors {
+			require.Equal(t, color.RGBA64Model.Convert(p.Colors[idx]), actual.Colors[idx])
+		}
+	}
+
+	p := New(color.Palette{color.RGBA{R: 10, G: 20, B: 30, A: 255}})
+	path := filepath.Join(t.TempDir(), "test.ase")
+	require.NoError(t, WriteFile(path, p))
+	actual, err := ReadFile(path)
+	require.NoError(t, err)
+	requireColorsNear(t, p.Colors, actual.Colors)
+}
+
+func TestReadASEErrors(t *testing.T) {
+	header := func(blocks uint32) []byte {
+		return bigEndian(t, []byte(aseMagic), []uint16{1, 0}, blocks)
+	}
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"magic":     bigEndian(t, []byte("ASEX"), []uint16{1, 0}, uint32(0)),
+		"version":   bigEndian(t, []byte(aseMagic), []uint16{2, 0}, uint32(0)),
+		"truncated": header(1),
+		"length":    append(header(1), bigEndian(t, uint16(aseColor), uint32(1<<30))...),
+		"model":     append(header(1), aseColorBlock(t, "", "XYZ ", 1, 2, 3)...),
+		"values":    append(header(1), aseBlock(t, aseColor, bigEndian(t, uint16(1), uint16(0), []byte("RGB "), float32(1)))...),
+	} {
+		_, err := ReadASE(bytes.NewReader(data))
+		require.Error(t, err, name)
+	}
+}
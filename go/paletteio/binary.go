@@ -0,0 +1,59 @@
+package paletteio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// The Adobe swatch formats are big-endian and store names as null-terminated
+// UTF-16 strings, prefixed by their length in code units.
+
+// maxNameLength is the maximum length of a swatch name, in UTF-16 code units.
+const maxNameLength = 0xffff
+
+// readUTF16 reads n big-endian UTF-16 code units and returns them as a string,
+// stopping at the first null.
+func readUTF16(r io.Reader, n int) (string, error) {
+	if n > maxNameLength {
+		return "", fmt.Errorf("name length %d is too long", n)
+	}
+	units := make([]uint16, n)
+	if err := binary.Read(r, binary.BigEndian, units); err != nil {
+		return "", err
+	}
+	for idx, u := range units {
+		if u == 0 {
+			units = units[:idx]
+			break
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// utf16Units returns the null-terminated UTF-16 encoding of the string.
+func utf16Units(s string) []uint16 {
+	return append(utf16.Encode([]rune(s)), 0)
+}
+
+// unit returns the value as a fraction of max, clamped to [0, 1].
+func unit(v, max float64) float64 {
+	return math.Max(0, math.Min(1, v/max))
+}
+
+// rgb64 converts channels in [0, 1] to an opaque color.RGBA64.
+func rgb64(r, g, b float64) color.RGBA64 {
+	scale := func(v float64) uint16 {
+		return uint16(math.Round(math.Max(0, math.Min(1, v)) * 0xffff))
+	}
+	return color.RGBA64{R: scale(r), G: scale(g), B: scale(b), A: 0xffff}
+}
+
+// cmykToRGB converts CMYK ink coverage in [0, 1] to RGB, using the same naive
+// conversion as color.CMYK.
+func cmykToRGB(c, m, y, k float64) color.RGBA64 {
+	return rgb64((1-c)*(1-k), (1-m)*(1-k), (1-y)*(1-k))
+}
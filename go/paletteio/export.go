@@ -0,0 +1,167 @@
+package paletteio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	goformat "go/format"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/erock2112/kmeans/go/palette"
+)
+
+// The formats in this file are for use in source code and cannot be read back.
+// Colors without names are named using NameByIndex; use Palette.WithNames to
+// name them differently.
+
+// slug converts a name to lower case words separated by hyphens, which are
+// valid in CSS, SCSS and design token names. Names with no letters or digits
+// produce the empty string.
+func slug(name string) string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words = append(words, word)
+	}
+	return strings.Join(words, "-")
+}
+
+// exportNames returns the prefix under which the palette's colors are grouped,
+// derived from the palette name, and a unique slug for each color.
+func exportNames(p *Palette) (string, []string) {
+	prefix := slug(p.Name)
+	if prefix == "" {
+		prefix = "color"
+	}
+	slugs := &Palette{Colors: p.Colors, Names: make([]string, len(p.Colors))}
+	for idx := range p.Colors {
+		slugs.Names[idx] = slug(p.ColorName(idx))
+	}
+	return prefix, slugs.WithNames(NameByIndex).Names
+}
+
+// WriteCSS writes the palette as CSS custom properties on the :root element,
+// eg. "--brand-orange: #ff8000;".
+func WriteCSS(w io.Writer, p *Palette) error {
+	prefix, names := exportNames(p)
+	bw := bufio.NewWriter(w)
+	bw.WriteString(":root {\n")
+	for idx, c := range p.Colors {
+		fmt.Fprintf(bw, "  --%s-%s: %s;\n", prefix, names[idx], palette.ColorToHex(c))
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// WriteSCSS writes the palette as SCSS variables, eg. "$brand-orange: #ff8000;",
+// followed by a map of all of the colors.
+func WriteSCSS(w io.Writer, p *Palette) error {
+	prefix, names := exportNames(p)
+	bw := bufio.NewWriter(w)
+	for idx, c := range p.Colors {
+		fmt.Fprintf(bw, "$%s-%s: %s;\n", prefix, names[idx], palette.ColorToHex(c))
+	}
+	fmt.Fprintf(bw, "\n$%s-palette: (\n", prefix)
+	for idx := range p.Colors {
+		fmt.Fprintf(bw, "  \"%s\": $%s-%s,\n", names[idx], prefix, names[idx])
+	}
+	bw.WriteString(");\n")
+	return bw.Flush()
+}
+
+// WriteTokens writes the palette as a W3C design tokens JSON file, in which
+// the colors are tokens of type "color" in a group named after the palette.
+// Colors are written in palette order.
+func WriteTokens(w io.Writer, p *Palette) error {
+	prefix, names := exportNames(p)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "{\n  %s: {\n", jsonString(prefix))
+	for idx, c := range p.Colors {
+		sep := ","
+		if idx == len(p.Colors)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(bw, "    %s: {\n      \"$type\": \"color\",\n      \"$value\": %s\n    }%s\n", jsonString(names[idx]), jsonString(palette.ColorToHex(c)), sep)
+	}
+	bw.WriteString("  }\n}\n")
+	return bw.Flush()
+}
+
+// jsonString returns s as a JSON string literal.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// WriteTailwind writes the palette as a Tailwind CSS configuration file which
+// extends the theme with the colors, grouped under the palette name. The
+// "colors" object may be copied into an existing configuration.
+func WriteTailwind(w io.Writer, p *Palette) error {
+	prefix, names := exportNames(p)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "module.exports = {\n  theme: {\n    extend: {\n      colors: {\n        %s: {\n", jsonString(prefix))
+	for idx, c := range p.Colors {
+		fmt.Fprintf(bw, "          %s: %s,\n", jsonString(names[idx]), jsonString(palette.ColorToHex(c)))
+	}
+	bw.WriteString("        },\n      },\n    },\n  },\n};\n")
+	return bw.Flush()
+}
+
+// goIdentifier converts a name to an exported Go identifier, or returns the
+// empty string if the name has no letters or digits. Names which do not start
+// with an upper case letter, such as those starting with a digit, are
+// prefixed with "Palette".
+func goIdentifier(name string) string {
+	var sb strings.Builder
+	for _, word := range strings.Split(slug(name), "-") {
+		if word != "" {
+			first, size := utf8.DecodeRuneInString(word)
+			sb.WriteRune(unicode.ToUpper(first))
+			sb.WriteString(word[size:])
+		}
+	}
+	rv := sb.String()
+	if first, _ := utf8.DecodeRuneInString(rv); rv != "" && !unicode.IsUpper(first) {
+		rv = "Palette" + rv
+	}
+	return rv
+}
+
+// WriteGo writes the palette as a Go source file in package "palette" which
+// declares a color.Palette variable named after the palette, or "Palette" if
+// it has no name. Color names are written as comments.
+func WriteGo(w io.Writer, p *Palette) error {
+	_, names := exportNames(p)
+	variable := goIdentifier(p.Name)
+	if variable == "" {
+		variable = "Palette"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by paletteio. DO NOT EDIT.\n\npackage palette\n\nimport \"image/color\"\n\n")
+	if p.Name != "" {
+		fmt.Fprintf(&buf, "// %s is the %q palette.\n", variable, p.Name)
+	}
+	fmt.Fprintf(&buf, "var %s = color.Palette{\n", variable)
+	for idx, c := range p.Colors {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		typ := "NRGBA"
+		if n.A == math.MaxUint8 {
+			typ = "RGBA"
+		}
+		fmt.Fprintf(&buf, "color.%s{R: 0x%02x, G: 0x%02x, B: 0x%02x, A: 0x%02x}, // %s\n", typ, n.R, n.G, n.B, n.A, names[idx])
+	}
+	buf.WriteString("}\n")
+	src, err := goformat.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
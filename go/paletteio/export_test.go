@@ -0,0 +1,153 @@
+package paletteio
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exportPalette returns a palette with a mixture of named, unnamed and
+// translucent colors.
+func exportPalette() *Palette {
+	return &Palette{
+		Name: "Brand Colors",
+		Colors: color.Palette{
+			color.RGBA{R: 255, G: 128, A: 255},
+			color.RGBA{R: 1, G: 2, B: 3, A: 255},
+			color.NRGBA{B: 255, A: 128},
+		},
+		Names: []string{"Burnt Orange", "", "Sky (50%)"},
+	}
+}
+
+func TestWriteCSS(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSS(&buf, exportPalette()))
+	require.Equal(t, `:root {
+  --brand-colors-burnt-orange: #ff8000;
+  --brand-colors-color-2: #010203;
+  --brand-colors-sky-50: #0000ff80;
+}
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteCSS(&buf, New(color.Palette{color.Black})))
+	require.Equal(t, ":root {\n  --color-color-1: #000000;\n}\n", buf.String())
+}
+
+func TestWriteSCSS(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSCSS(&buf, exportPalette()))
+	require.Equal(t, `$brand-colors-burnt-orange: #ff8000;
+$brand-colors-color-2: #010203;
+$brand-colors-sky-50: #0000ff80;
+
+$brand-colors-palette: (
+  "burnt-orange": $brand-colors-burnt-orange,
+  "color-2": $brand-colors-color-2,
+  "sky-50": $brand-colors-sky-50,
+);
+`, buf.String())
+}
+
+func TestWriteTokens(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteTokens(&buf, exportPalette()))
+	var tokens map[string]map[string]map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &tokens))
+	require.Equal(t, map[string]map[string]map[string]string{
+		"brand-colors": {
+			"burnt-orange": {"$type": "color", "$value": "#ff8000"},
+			"color-2":      {"$type": "color", "$value": "#010203"},
+			"sky-50":       {"$type": "color", "$value": "#0000ff80"},
+		},
+	}, tokens)
+	// Colors are written in palette order.
+	require.Less(t, bytes.Index(buf.Bytes(), []byte("burnt-orange")), bytes.Index(buf.Bytes(), []byte("color-2")))
+
+	buf.Reset()
+	require.NoError(t, WriteTokens(&buf, &Palette{}))
+	require.True(t, json.Valid(buf.Bytes()))
+}
+
+func TestWriteTailwind(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteTailwind(&buf, exportPalette()))
+	require.Equal(t, `module.exports = {
+  theme: {
+    extend: {
+      colors: {
+        "brand-colors": {
+          "burnt-orange": "#ff8000",
+          "color-2": "#010203",
+          "sky-50": "#0000ff80",
+        },
+      },
+    },
+  },
+};
+`, buf.String())
+}
+
+func TestWriteGo(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteGo(&buf, exportPalette()))
+	require.Equal(t, `// Code generated by paletteio. DO NOT EDIT.
+
+package palette
+
+import "image/color"
+
+// BrandColors is the "Brand Colors" palette.
+var BrandColors = color.Palette{
+	color.RGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff},  // burnt-orange
+	color.RGBA{R: 0x01, G: 0x02, B: 0x03, A: 0xff},  // color-2
+	color.NRGBA{R: 0x00, G: 0x00, B: 0xff, A: 0x80}, // sky-50
+}
+`, buf.String())
+	_, err := parser.ParseFile(token.NewFileSet(), "palette.go", buf.Bytes(), 0)
+	require.NoError(t, err)
+
+	for name, variable := range map[string]string{
+		"":           "Palette",
+		"8-bit":      "Palette8Bit",
+		"!!!":        "Palette",
+		"élan vital": "ÉlanVital",
+		"über-grün":  "ÜberGrün",
+		"日本の色":       "Palette日本の色",
+	} {
+		buf.Reset()
+		require.NoError(t, WriteGo(&buf, &Palette{Name: name, Colors: color.Palette{color.Black}}))
+		require.Contains(t, buf.String(), "var "+variable+" = color.Palette{", name)
+		_, err := parser.ParseFile(token.NewFileSet(), "palette.go", buf.Bytes(), 0)
+		require.NoError(t, err, name)
+	}
+}
+
+func TestExportFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, ext := range ExportExtensions() {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(dir, "test"+ext)
+			require.NoError(t, WriteFile(path, exportPalette()))
+			contents, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Contains(t, string(contents), "burnt-orange")
+
+			_, err = ReadFile(path)
+			require.ErrorContains(t, err, "cannot be read")
+		})
+	}
+	for _, name := range ExportFormatNames() {
+		require.NoError(t, WriteFormat(&bytes.Buffer{}, name, exportPalette()))
+		_, err := ReadFormat(&bytes.Buffer{}, name)
+		require.Error(t, err)
+	}
+}
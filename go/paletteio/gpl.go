@@ -0,0 +1,108 @@
+package paletteio
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// gplMagic is the first line of every GIMP palette file.
+const gplMagic = "GIMP Palette"
+
+// ReadGPL reads a palette in the GIMP .gpl format, which is also used by
+// Inkscape and Krita. Colors are opaque color.RGBA values.
+func ReadGPL(r io.Reader) (*Palette, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty GPL file")
+	}
+	if strings.TrimSpace(strings.TrimPrefix(scanner.Text(), bom)) != gplMagic {
+		return nil, fmt.Errorf("not a GPL file; expected %q header", gplMagic)
+	}
+	rv := &Palette{}
+	lineNum := 1
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if value, ok := gplHeader(line, "Name"); ok {
+			rv.Name = value
+			continue
+		}
+		if value, ok := gplHeader(line, "Columns"); ok {
+			columns, err := strconv.Atoi(value)
+			if err != nil || columns < 0 {
+				return nil, fmt.Errorf("line %d: invalid column count %q", lineNum, value)
+			}
+			rv.Columns = columns
+			continue
+		}
+		var rgb [3]uint8
+		rest := line
+		for idx := range rgb {
+			var field string
+			field, rest = nextField(rest)
+			v, err := strconv.ParseUint(field, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: expected \"R G B [name]\" but found %q", lineNum, line)
+			}
+			rgb[idx] = uint8(v)
+		}
+		rv.Add(color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}, rest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// gplHeader returns the value of the given "Key: value" header line, and
+// whether the line is such a header.
+func gplHeader(line, key string) (string, bool) {
+	if !strings.HasPrefix(line, key+":") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, key+":")), true
+}
+
+// nextField splits the first whitespace-separated field from the string, and
+// returns it along with the remainder of the string, trimmed of whitespace.
+func nextField(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexAny(s, " \t")
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:idx], strings.TrimSpace(s[idx:])
+}
+
+// WriteGPL writes the palette in the GIMP .gpl format. Alpha is discarded.
+func WriteGPL(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, gplMagic)
+	name := strings.TrimSpace(strings.ReplaceAll(p.Name, "\n", " "))
+	if name != "" {
+		fmt.Fprintf(bw, "Name: %s\n", name)
+	}
+	if p.Columns > 0 {
+		fmt.Fprintf(bw, "Columns: %d\n", p.Columns)
+	}
+	fmt.Fprintln(bw, "#")
+	for idx, c := range p.Colors {
+		rgba := opaque(c)
+		line := fmt.Sprintf("%3d %3d %3d", rgba.R, rgba.G, rgba.B)
+		if name := strings.TrimSpace(strings.ReplaceAll(p.ColorName(idx), "\n", " ")); name != "" {
+			line += "\t" + name
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
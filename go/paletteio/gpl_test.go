@@ -0,0 +1,98 @@
+package paletteio
+
+import (
+	"bytes"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testGPL = `GIMP Palette
+Name: Test  Palette
+Columns: 4
+#
+# A comment.
+255   0   0	Red
+  0 128   0	Dark  green
+  0   0 255
+ 18  52  86	#123456
+`
+
+func TestReadGPL(t *testing.T) {
+	p, err := ReadGPL(strings.NewReader(testGPL))
+	require.NoError(t, err)
+	require.Equal(t, &Palette{
+		Name:    "Test  Palette",
+		Columns: 4,
+		Colors: color.Palette{
+			color.RGBA{R: 255, A: 255},
+			color.RGBA{G: 128, A: 255},
+			color.RGBA{B: 255, A: 255},
+			color.RGBA{R: 18, G: 52, B: 86, A: 255},
+		},
+		Names: []string{"Red", "Dark  green", "", "#123456"},
+	}, p)
+}
+
+func TestReadGPLErrors(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"JASC-PAL\n",
+		"GIMP Palette\nColumns: x\n",
+		"GIMP Palette\n1 2\n",
+		"GIMP Palette\n1 2 256\n",
+	} {
+		_, err := ReadGPL(strings.NewReader(content))
+		require.Error(t, err, content)
+	}
+}
+
+func TestWriteGPL(t *testing.T) {
+	p := &Palette{
+		Name:    "Test",
+		Columns: 2,
+		Colors: color.Palette{
+			color.RGBA{R: 1, G: 2, B: 3, A: 255},
+			color.NRGBA{R: 255, G: 128, B: 0, A: 128},
+		},
+		Names: []string{"", "Orange"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteGPL(&buf, p))
+	require.Equal(t, "GIMP Palette\nName: Test\nColumns: 2\n#\n  1   2   3\n255 128   0\tOrange\n", buf.String())
+
+	// Alpha is discarded on round trip.
+	actual, err := ReadGPL(&buf)
+	require.NoError(t, err)
+	p.Colors[1] = color.RGBA{R: 255, G: 128, B: 0, A: 255}
+	require.Equal(t, p, actual)
+}
+
+func TestReadWriteFile(t *testing.T) {
+	p := New(color.Palette{color.RGBA{R: 10, G: 20, B: 30, A: 255}, color.RGBA{A: 255}})
+	p.Name = "File"
+	path := filepath.Join(t.TempDir(), "test.GPL")
+	require.NoError(t, WriteFile(path, p))
+	actual, err := ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, p, actual)
+
+	require.Error(t, WriteFile(filepath.Join(t.TempDir(), "test.bogus"), p))
+	_, err = ReadFile(filepath.Join(t.TempDir(), "missing.gpl"))
+	require.Error(t, err)
+}
+
+func TestAdd(t *testing.T) {
+	p := &Palette{}
+	p.Add(color.Black, "")
+	require.Nil(t, p.Names)
+	p.Add(color.White, "White")
+	require.Equal(t, []string{"", "White"}, p.Names)
+	p.Add(color.Black, "")
+	require.Equal(t, []string{"", "White", ""}, p.Names)
+	require.Equal(t, "White", p.ColorName(1))
+	require.Equal(t, "", p.ColorName(5))
+}
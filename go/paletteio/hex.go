@@ -0,0 +1,138 @@
+package paletteio
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// paintNETHeader is written at the start of Paint.NET palette files.
+const paintNETHeader = `; paint.net Palette File
+; Lines that start with a semicolon are comments.
+; Colors are written as 8-digit hexadecimal numbers: aarrggbb.
+`
+
+var (
+	// paintNETLine matches a color in a Paint.NET palette file.
+	paintNETLine = regexp.MustCompile(`^(?i)[0-9a-f]{8}$`)
+	// hexLine matches a color in a hex list file.
+	hexLine = regexp.MustCompile(`^(?i)#?([0-9a-f]{6}|[0-9a-f]{8})$`)
+)
+
+// scanLines calls fn for each non-empty line of the input, trimmed of
+// whitespace, except for comments beginning with the given prefix. The line
+// number of each line is passed to fn, for use in error messages.
+func scanLines(r io.Reader, commentPrefix string, fn func(lineNum int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, bom)
+		}
+		if line == "" || (commentPrefix != "" && strings.HasPrefix(line, commentPrefix)) {
+			continue
+		}
+		if err := fn(lineNum, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// hexByte parses the two hex digits of s starting at idx. s must already have
+// been validated.
+func hexByte(s string, idx int) uint8 {
+	v, _ := strconv.ParseUint(s[idx:idx+2], 16, 8)
+	return uint8(v)
+}
+
+// nrgba returns the color as a color.RGBA if it is opaque, or a color.NRGBA
+// otherwise, matching the convention of palette.HexToColor.
+func nrgba(r, g, b, a uint8) color.Color {
+	if a == math.MaxUint8 {
+		return color.RGBA{R: r, G: g, B: b, A: a}
+	}
+	return color.NRGBA{R: r, G: g, B: b, A: a}
+}
+
+// ReadPaintNET reads a palette in the Paint.NET .txt format, in which each
+// color is written as "aarrggbb". Opaque colors are returned as color.RGBA and
+// translucent colors as color.NRGBA.
+func ReadPaintNET(r io.Reader) (*Palette, error) {
+	rv := &Palette{}
+	err := scanLines(r, ";", func(lineNum int, line string) error {
+		if !paintNETLine.MatchString(line) {
+			return fmt.Errorf("line %d: expected \"aarrggbb\" but found %q", lineNum, line)
+		}
+		rv.Colors = append(rv.Colors, nrgba(hexByte(line, 2), hexByte(line, 4), hexByte(line, 6), hexByte(line, 0)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// WritePaintNET writes the palette in the Paint.NET .txt format. Paint.NET
+// itself only uses the first 96 colors. The palette name, if any, is written as
+// a comment; the column count and color names are not stored.
+func WritePaintNET(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(paintNETHeader)
+	if name := strings.TrimSpace(strings.ReplaceAll(p.Name, "\n", " ")); name != "" {
+		fmt.Fprintf(bw, "; Palette: %s\n", name)
+	}
+	for _, c := range p.Colors {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		fmt.Fprintf(bw, "%02X%02X%02X%02X\n", n.A, n.R, n.G, n.B)
+	}
+	return bw.Flush()
+}
+
+// ReadHex reads a palette in the plain .hex list format used by Lospec, in
+// which each line holds a color as "rrggbb". A leading "#" and a trailing alpha
+// channel, as in "#rrggbbaa", are also accepted. Opaque colors are returned as
+// color.RGBA and translucent colors as color.NRGBA.
+func ReadHex(r io.Reader) (*Palette, error) {
+	rv := &Palette{}
+	err := scanLines(r, "", func(lineNum int, line string) error {
+		m := hexLine.FindStringSubmatch(line)
+		if m == nil {
+			return fmt.Errorf("line %d: expected \"rrggbb\" but found %q", lineNum, line)
+		}
+		hex := m[1]
+		a := uint8(math.MaxUint8)
+		if len(hex) == 8 {
+			a = hexByte(hex, 6)
+		}
+		rv.Colors = append(rv.Colors, nrgba(hexByte(hex, 0), hexByte(hex, 2), hexByte(hex, 4), a))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// WriteHex writes the palette in the plain .hex list format. Opaque colors are
+// written as "rrggbb" and translucent colors as "rrggbbaa". The palette name,
+// column count and color names are not stored.
+func WriteHex(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range p.Colors {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		if n.A == math.MaxUint8 {
+			fmt.Fprintf(bw, "%02x%02x%02x\n", n.R, n.G, n.B)
+		} else {
+			fmt.Fprintf(bw, "%02x%02x%02x%02x\n", n.R, n.G, n.B, n.A)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,55 @@
+package paletteio
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaintNET(t *testing.T) {
+	p, err := ReadPaintNET(strings.NewReader("; paint.net Palette File\n;comment\nFFFF8000\n\n800000ff\n"))
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{
+		color.RGBA{R: 255, G: 128, A: 255},
+		color.NRGBA{B: 255, A: 128},
+	}), p)
+
+	p.Name = "Test"
+	var buf bytes.Buffer
+	require.NoError(t, WritePaintNET(&buf, p))
+	require.Equal(t, paintNETHeader+"; Palette: Test\nFFFF8000\n800000FF\n", buf.String())
+	actual, err := ReadPaintNET(&buf)
+	require.NoError(t, err)
+	p.Name = ""
+	require.Equal(t, p, actual)
+
+	for _, content := range []string{"FF8000\n", "FFFF8000 name\n", "GGFF8000\n"} {
+		_, err := ReadPaintNET(strings.NewReader(content))
+		require.Error(t, err, content)
+	}
+}
+
+func TestHex(t *testing.T) {
+	p, err := ReadHex(strings.NewReader("ff8000\n#0000FF\n\n12345680\n"))
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{
+		color.RGBA{R: 255, G: 128, A: 255},
+		color.RGBA{B: 255, A: 255},
+		color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0x80},
+	}), p)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHex(&buf, p))
+	require.Equal(t, "ff8000\n0000ff\n12345680\n", buf.String())
+	actual, err := ReadHex(&buf)
+	require.NoError(t, err)
+	require.Equal(t, p, actual)
+
+	for _, content := range []string{"ff80\n", "ff8000 orange\n", "#ff80001\n", "; comment\n"} {
+		_, err := ReadHex(strings.NewReader(content))
+		require.Error(t, err, content)
+	}
+}
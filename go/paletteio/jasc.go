@@ -0,0 +1,83 @@
+package paletteio
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jascMagic and jascVersion are the first two lines of every JASC-PAL file.
+const (
+	jascMagic   = "JASC-PAL"
+	jascVersion = "0100"
+)
+
+// ReadJASC reads a palette in the JASC-PAL .pal format used by Paint Shop Pro,
+// Aseprite and Pro Motion. Colors are opaque color.RGBA values.
+func ReadJASC(r io.Reader) (*Palette, error) {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	nextLine := func() (string, bool) {
+		for scanner.Scan() {
+			lineNum++
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				return line, true
+			}
+		}
+		return "", false
+	}
+	if line, _ := nextLine(); strings.TrimPrefix(line, bom) != jascMagic {
+		return nil, fmt.Errorf("not a JASC-PAL file; expected %q header", jascMagic)
+	}
+	if line, _ := nextLine(); line != jascVersion {
+		return nil, fmt.Errorf("unsupported JASC-PAL version %q", line)
+	}
+	line, _ := nextLine()
+	count, err := strconv.Atoi(line)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("line %d: invalid color count %q", lineNum, line)
+	}
+	rv := &Palette{}
+	for idx := 0; idx < count; idx++ {
+		line, ok := nextLine()
+		if !ok {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("expected %d colors but found %d", count, idx)
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected \"R G B\" but found %q", lineNum, line)
+		}
+		var rgb [3]uint8
+		for channel := range rgb {
+			v, err := strconv.ParseUint(fields[channel], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid color channel %q", lineNum, fields[channel])
+			}
+			rgb[channel] = uint8(v)
+		}
+		rv.Colors = append(rv.Colors, color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// WriteJASC writes the palette in the JASC-PAL .pal format, with CRLF line
+// endings as written by Paint Shop Pro. Alpha is discarded, and the palette
+// name, column count and color names are not stored.
+func WriteJASC(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\r\n%s\r\n%d\r\n", jascMagic, jascVersion, len(p.Colors))
+	for _, c := range p.Colors {
+		rgba := opaque(c)
+		fmt.Fprintf(bw, "%d %d %d\r\n", rgba.R, rgba.G, rgba.B)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,45 @@
+package paletteio
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadJASC(t *testing.T) {
+	p, err := ReadJASC(strings.NewReader("JASC-PAL\r\n0100\r\n3\r\n255 0 0\r\n0 128 0\r\n1 2 3 255\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{
+		color.RGBA{R: 255, A: 255},
+		color.RGBA{G: 128, A: 255},
+		color.RGBA{R: 1, G: 2, B: 3, A: 255},
+	}), p)
+}
+
+func TestWriteJASC(t *testing.T) {
+	p := New(color.Palette{color.RGBA{R: 1, G: 2, B: 3, A: 255}, color.NRGBA{R: 255, G: 128, A: 10}})
+	var buf bytes.Buffer
+	require.NoError(t, WriteJASC(&buf, p))
+	require.Equal(t, "JASC-PAL\r\n0100\r\n2\r\n1 2 3\r\n255 128 0\r\n", buf.String())
+	actual, err := ReadJASC(&buf)
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{color.RGBA{R: 1, G: 2, B: 3, A: 255}, color.RGBA{R: 255, G: 128, A: 255}}), actual)
+}
+
+func TestReadJASCErrors(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"GIMP Palette\n",
+		"JASC-PAL\n0200\n0\n",
+		"JASC-PAL\n0100\nx\n",
+		"JASC-PAL\n0100\n2\n1 2 3\n",
+		"JASC-PAL\n0100\n1\n1 2\n",
+		"JASC-PAL\n0100\n1\n1 2 300\n",
+	} {
+		_, err := ReadJASC(strings.NewReader(content))
+		require.Error(t, err, content)
+	}
+}
@@ -0,0 +1,57 @@
+package paletteio
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameByIndex(t *testing.T) {
+	require.Equal(t, []string{"color-1", "color-2", "color-3"}, NameByIndex(testPalette().Colors))
+}
+
+func TestNameByLuminosity(t *testing.T) {
+	require.Equal(t, []string{"200", "300", "100", "400"}, NameByLuminosity(color.Palette{
+		color.RGBA{R: 128, G: 128, B: 128, A: 255},
+		color.RGBA{R: 10, G: 10, B: 10, A: 255},
+		color.White,
+		color.RGBA{R: 10, G: 10, B: 10, A: 255},
+	}))
+}
+
+func TestNameByCSSColor(t *testing.T) {
+	require.Equal(t, []string{"red", "black", "white", "tomato", "navy"}, NameByCSSColor(color.Palette{
+		color.RGBA{R: 254, G: 1, A: 255},
+		color.RGBA{R: 3, G: 3, B: 3, A: 255},
+		color.NRGBA{R: 255, G: 255, B: 255, A: 10},
+		color.RGBA{R: 0xff, G: 0x63, B: 0x48, A: 255},
+		color.RGBA{B: 0x80, A: 255},
+	}))
+}
+
+func TestParseNamer(t *testing.T) {
+	for _, name := range NamerNames {
+		namer, err := ParseNamer(name)
+		require.NoError(t, err)
+		require.Len(t, namer(testPalette().Colors), len(testPalette().Colors))
+	}
+	_, err := ParseNamer("bogus")
+	require.Error(t, err)
+}
+
+func TestWithNames(t *testing.T) {
+	p := &Palette{
+		Name:   "Test",
+		Colors: color.Palette{color.Black, color.White, color.Black, color.Black, color.White},
+		Names:  []string{"", "Paper", "black-2", "", ""},
+	}
+	actual := p.WithNames(NameByCSSColor)
+	require.Equal(t, []string{"black", "Paper", "black-2", "black-3", "white"}, actual.Names)
+	require.Equal(t, "Test", actual.Name)
+	require.Equal(t, p.Colors, actual.Colors)
+	// The original is unchanged.
+	require.Equal(t, []string{"", "Paper", "black-2", "", ""}, p.Names)
+
+	require.Equal(t, NameByIndex(testPalette().Colors), testPalette().WithNames(NameByIndex).Names)
+}
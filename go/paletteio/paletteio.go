@@ -0,0 +1,326 @@
+// Package paletteio reads and writes color palettes in the file formats used
+// by image editors and design tools, such as GIMP's .gpl format, as well as
+// swatch images of solid color blocks.
+package paletteio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Palette is a color palette along with the metadata which palette file
+// formats may store alongside it.
+type Palette struct {
+	// Name is the name of the palette as a whole. It may be empty.
+	Name string
+	// Columns is the number of columns in which editors should display the
+	// palette. Zero means unspecified.
+	Columns int
+	// Colors holds the colors of the palette, in order.
+	Colors color.Palette
+	// Names holds the name of each color. It is either empty or the same
+	// length as Colors, and individual names may be empty.
+	Names []string
+}
+
+// New returns a Palette with the given colors and no metadata.
+func New(colors color.Palette) *Palette {
+	return &Palette{Colors: append(color.Palette{}, colors...)}
+}
+
+// ColorName returns the name of the color at the given index, or the empty
+// string if it has none.
+func (p *Palette) ColorName(idx int) string {
+	if idx < len(p.Names) {
+		return p.Names[idx]
+	}
+	return ""
+}
+
+// Add appends a color with the given name to the Palette.
+func (p *Palette) Add(c color.Color, name string) {
+	if name != "" || len(p.Names) > 0 {
+		p.Names = append(p.Names, make([]string, len(p.Colors)-len(p.Names))...)
+		p.Names = append(p.Names, name)
+	}
+	p.Colors = append(p.Colors, c)
+}
+
+// opaque converts the color to an opaque color.RGBA, for formats which do not
+// support alpha.
+func opaque(c color.Color) color.RGBA {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return color.RGBA{R: n.R, G: n.G, B: n.B, A: 0xff}
+}
+
+// opaque64 is like opaque, but retains 16 bits per channel.
+func opaque64(c color.Color) color.RGBA64 {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return color.RGBA64{R: n.R, G: n.G, B: n.B, A: 0xffff}
+}
+
+// bom is the UTF-8 byte order mark, which some editors write at the start of
+// text files.
+const bom = "\ufeff"
+
+// format reads and writes a palette file format. Formats which are only
+// exported, for use in source code, have no detect or read functions.
+type format struct {
+	name       string
+	extensions []string
+	// detect reports whether the start of a file is in this format.
+	detect func(header []byte) bool
+	read   func(io.Reader) (*Palette, error)
+	write  func(io.Writer, *Palette) error
+}
+
+// exportOnly reports whether the format can be written but not read.
+func (f format) exportOnly() bool {
+	return f.read == nil
+}
+
+// hasMagic returns a detect function which checks for the given signature,
+// ignoring any byte order mark.
+func hasMagic(magic string) func([]byte) bool {
+	return func(header []byte) bool {
+		return bytes.HasPrefix(bytes.TrimPrefix(header, []byte(bom)), []byte(magic))
+	}
+}
+
+// allLines returns a detect function which checks that every non-empty line of
+// the header, except for comments beginning with the given prefix, matches the
+// given regular expression. The last line may be truncated, so it is ignored.
+func allLines(commentPrefix string, re *regexp.Regexp) func([]byte) bool {
+	return func(header []byte) bool {
+		lines := strings.Split(strings.TrimPrefix(string(header), bom), "\n")
+		if len(lines) > 1 {
+			lines = lines[:len(lines)-1]
+		}
+		found := false
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" || (commentPrefix != "" && strings.HasPrefix(line, commentPrefix)) {
+				continue
+			}
+			if !re.MatchString(line) {
+				return false
+			}
+			found = true
+		}
+		return found
+	}
+}
+
+// detectACO checks for the version number at the start of an ACO file. Text
+// formats never begin with a null byte, so this is reliable in practice.
+func detectACO(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	version := binary.BigEndian.Uint16(header)
+	return version == 1 || version == 2
+}
+
+// formats lists the supported palette file formats, in the order in which
+// detection is attempted. Formats with a signature come first. Hex lists are
+// tried before Paint.NET files, since "rrggbbaa" and "aarrggbb" lines look the
+// same; Paint.NET files are recognized by their ";" comments, which hex lists
+// may not contain.
+var formats = []format{
+	{name: "gpl", extensions: []string{".gpl"}, detect: hasMagic(gplMagic), read: ReadGPL, write: WriteGPL},
+	{name: "jasc", extensions: []string{".pal"}, detect: hasMagic(jascMagic), read: ReadJASC, write: WriteJASC},
+	{name: "ase", extensions: []string{".ase"}, detect: hasMagic(aseMagic), read: ReadASE, write: WriteASE},
+	{name: "png", extensions: []string{".png"}, detect: hasMagic("\x89PNG\r\n\x1a\n"), read: ReadImage, write: WritePNG},
+	{name: "jpeg", extensions: []string{".jpg", ".jpeg"}, detect: hasMagic("\xff\xd8\xff"), read: ReadImage, write: WriteJPEG},
+	{name: "gif", extensions: []string{".gif"}, detect: hasMagic("GIF8"), read: ReadImage, write: WriteGIF},
+	{name: "aco", extensions: []string{".aco"}, detect: detectACO, read: ReadACO, write: WriteACO},
+	{name: "hex", extensions: []string{".hex"}, detect: allLines("", hexLine), read: ReadHex, write: WriteHex},
+	{name: "paintnet", extensions: []string{".txt"}, detect: allLines(";", paintNETLine), read: ReadPaintNET, write: WritePaintNET},
+	{name: "css", extensions: []string{".css"}, write: WriteCSS},
+	{name: "scss", extensions: []string{".scss"}, write: WriteSCSS},
+	{name: "tokens", extensions: []string{".json"}, write: WriteTokens},
+	{name: "tailwind", extensions: []string{".js"}, write: WriteTailwind},
+	{name: "go", extensions: []string{".go"}, write: WriteGo},
+}
+
+// sniffLength is the number of bytes examined to detect the format of a file.
+const sniffLength = 512
+
+// Extensions returns the file extensions of the palette formats which can be
+// both read and written, in sorted order.
+func Extensions() []string {
+	return extensions(false)
+}
+
+// ExportExtensions returns the file extensions of the formats which can be
+// written but not read, such as CSS, in sorted order.
+func ExportExtensions() []string {
+	return extensions(true)
+}
+
+// extensions returns the sorted file extensions of the formats which are, or
+// are not, export-only.
+func extensions(exportOnly bool) []string {
+	var rv []string
+	for _, f := range formats {
+		if f.exportOnly() == exportOnly {
+			rv = append(rv, f.extensions...)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// FormatNames returns the names of the palette formats which can be both read
+// and written, as accepted by ReadFormat and WriteFormat.
+func FormatNames() []string {
+	return formatNames(false)
+}
+
+// ExportFormatNames returns the names of the formats which can be written but
+// not read, as accepted by WriteFormat.
+func ExportFormatNames() []string {
+	return formatNames(true)
+}
+
+// formatNames returns the names of the formats which are, or are not,
+// export-only.
+func formatNames(exportOnly bool) []string {
+	var rv []string
+	for _, f := range formats {
+		if f.exportOnly() == exportOnly {
+			rv = append(rv, f.name)
+		}
+	}
+	return rv
+}
+
+// formatByName returns the format with the given name.
+func formatByName(name string) (format, error) {
+	for _, f := range formats {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return format{}, fmt.Errorf("unknown palette format %q; known formats: %s", name, strings.Join(append(FormatNames(), ExportFormatNames()...), ", "))
+}
+
+// formatForPath returns the format of the given file, based on its extension.
+func formatForPath(path string) (format, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		for _, fExt := range f.extensions {
+			if ext == fExt {
+				return f, nil
+			}
+		}
+	}
+	return format{}, fmt.Errorf("unsupported palette file extension %q; supported extensions: %s", ext, strings.Join(append(Extensions(), ExportExtensions()...), ", "))
+}
+
+// detectFormat returns the format of the file with the given header, or false
+// if it cannot be determined.
+func detectFormat(header []byte) (format, bool) {
+	for _, f := range formats {
+		if !f.exportOnly() && f.detect(header) {
+			return f, true
+		}
+	}
+	return format{}, false
+}
+
+// Read reads a palette in any supported format, which is detected from the
+// content.
+func Read(r io.Reader) (*Palette, error) {
+	br := bufio.NewReaderSize(r, sniffLength)
+	header, err := br.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	f, ok := detectFormat(header)
+	if !ok {
+		return nil, fmt.Errorf("unrecognized palette format")
+	}
+	return f.read(br)
+}
+
+// ReadFormat reads a palette in the named format.
+func ReadFormat(r io.Reader, name string) (*Palette, error) {
+	f, err := formatByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.exportOnly() {
+		return nil, fmt.Errorf("palette format %q cannot be read", name)
+	}
+	return f.read(r)
+}
+
+// WriteFormat writes a palette in the named format.
+func WriteFormat(w io.Writer, name string, p *Palette) error {
+	f, err := formatByName(name)
+	if err != nil {
+		return err
+	}
+	return f.write(w, p)
+}
+
+// ReadFile reads a palette from the given file. The format is determined by
+// the file extension if the content matches it; otherwise it is detected from
+// the content, since eg. ".pal" and ".txt" files may be in a number of formats.
+func ReadFile(path string) (*Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, sniffLength)
+	header, err := br.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	byExt, extErr := formatForPath(path)
+	if extErr == nil && byExt.exportOnly() {
+		extErr = fmt.Errorf("palette format %q cannot be read", byExt.name)
+	}
+	if extErr == nil && byExt.detect(header) {
+		return byExt.read(br)
+	}
+	if detected, ok := detectFormat(header); ok {
+		return detected.read(br)
+	}
+	if extErr != nil {
+		return nil, extErr
+	}
+	// Let the reader report what is wrong with the content.
+	return byExt.read(br)
+}
+
+// WriteFile writes a palette to the given file. The format is determined by
+// the file extension.
+func WriteFile(path string, p *Palette) (err error) {
+	format, err := formatForPath(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return format.write(f, p)
+}
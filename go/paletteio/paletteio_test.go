@@ -0,0 +1,108 @@
+package paletteio
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testPalette() *Palette {
+	return New(color.Palette{
+		color.RGBA{R: 255, G: 128, A: 255},
+		color.RGBA{R: 1, G: 2, B: 3, A: 255},
+		color.RGBA{B: 255, A: 255},
+	})
+}
+
+func TestDetectFormat(t *testing.T) {
+	for _, name := range FormatNames() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WriteFormat(&buf, name, testPalette()))
+			detected, ok := detectFormat(buf.Bytes())
+			require.True(t, ok)
+			require.Equal(t, name, detected.name)
+
+			p, err := Read(&buf)
+			require.NoError(t, err)
+			requireColorsNear(t, testPalette().Colors, p.Colors)
+		})
+	}
+	_, err := Read(bytes.NewReader([]byte("not a palette\n")))
+	require.Error(t, err)
+	_, err = Read(bytes.NewReader(nil))
+	require.Error(t, err)
+	require.Error(t, WriteFormat(&bytes.Buffer{}, "bogus", testPalette()))
+	_, err = ReadFormat(&bytes.Buffer{}, "bogus")
+	require.Error(t, err)
+}
+
+func TestReadWriteFileAllFormats(t *testing.T) {
+	dir := t.TempDir()
+	for _, ext := range Extensions() {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(dir, "test"+ext)
+			require.NoError(t, WriteFile(path, testPalette()))
+			p, err := ReadFile(path)
+			require.NoError(t, err)
+			requireColorsNear(t, testPalette().Colors, p.Colors)
+		})
+	}
+}
+
+func TestReadFileDetection(t *testing.T) {
+	dir := t.TempDir()
+
+	// A JASC-PAL file with a misleading extension is detected by content.
+	var buf bytes.Buffer
+	require.NoError(t, WriteJASC(&buf, testPalette()))
+	path := filepath.Join(dir, "jasc.txt")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	p, err := ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, testPalette(), p)
+
+	// Eight-digit lines could be Paint.NET or hex with alpha; the extension
+	// decides.
+	path = filepath.Join(dir, "alpha.hex")
+	require.NoError(t, os.WriteFile(path, []byte("ff000080\n"), 0644))
+	p, err = ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{color.NRGBA{R: 255, A: 128}}), p)
+	path = filepath.Join(dir, "alpha.txt")
+	require.NoError(t, os.WriteFile(path, []byte("ff000080\n"), 0644))
+	p, err = ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{color.RGBA{B: 128, A: 255}}), p)
+
+	// Without an extension to decide, eight-digit lines are hex with alpha,
+	// unless there is a Paint.NET comment.
+	p, err = Read(strings.NewReader("ff000080\n"))
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{color.NRGBA{R: 255, A: 128}}), p)
+	p, err = Read(strings.NewReader("; paint.net Palette File\nff000080\n"))
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{color.RGBA{B: 128, A: 255}}), p)
+
+	// Unknown extensions are fine if the content is recognized.
+	path = filepath.Join(dir, "palette.colors")
+	require.NoError(t, os.WriteFile(path, []byte("GIMP Palette\n1 2 3\n"), 0644))
+	p, err = ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, New(color.Palette{color.RGBA{R: 1, G: 2, B: 3, A: 255}}), p)
+
+	// Otherwise, errors come from the reader for the extension.
+	path = filepath.Join(dir, "bad.hex")
+	require.NoError(t, os.WriteFile(path, []byte("ff0000\nnope\n"), 0644))
+	_, err = ReadFile(path)
+	require.ErrorContains(t, err, "line 2")
+	path = filepath.Join(dir, "bad.colors")
+	require.NoError(t, os.WriteFile(path, []byte("nope\n"), 0644))
+	_, err = ReadFile(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,314 @@
+package paletteio
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+)
+
+// SwatchBlockSize is the size in pixels of each block in the images created by
+// SwatchImage.
+const SwatchBlockSize = 50
+
+const (
+	// swatchTolerance is the largest difference in any channel between
+	// neighboring pixels of a block, to allow for JPEG noise.
+	swatchTolerance = 48
+	// maxExactSwatchCells is the largest number of cells which an image may
+	// be divided into using exact color boundaries. Lossy images divide into
+	// many tiny cells, so this helps to distinguish them from
+	// 1-pixel-per-color images such as those from Lospec.
+	maxExactSwatchCells = 256
+	// swatchEdgeWidth is the number of pixels over which JPEG compression may
+	// blur the edge between two blocks.
+	swatchEdgeWidth = 3
+)
+
+// SwatchImage returns an image of the palette as a vertical strip of solid
+// blocks, each SwatchBlockSize pixels square.
+func SwatchImage(p color.Palette) *image.NRGBA {
+	rv := image.NewNRGBA(image.Rect(0, 0, SwatchBlockSize, SwatchBlockSize*len(p)))
+	for idx, c := range p {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		for y := idx * SwatchBlockSize; y < (idx+1)*SwatchBlockSize; y++ {
+			for x := 0; x < SwatchBlockSize; x++ {
+				rv.SetNRGBA(x, y, n)
+			}
+		}
+	}
+	return rv
+}
+
+// ReadSwatchImage extracts an ordered palette from an image of solid color
+// blocks, such as that created by SwatchImage. The blocks may be arranged in a
+// strip or a grid and may be of any size, down to one pixel per color, and are
+// detected automatically. JPEG noise is tolerated. Colors are returned in
+// row-major order, ie. left to right and then top to bottom. Fully transparent
+// blocks, such as padding at the end of a grid, are skipped. Adjacent blocks of
+// the same color cannot be distinguished, so they produce a single color.
+func ReadSwatchImage(img image.Image) (*Palette, error) {
+	pixels := swatchPixels(img)
+	if pixels.width == 0 || pixels.height == 0 {
+		return nil, fmt.Errorf("swatch image is empty")
+	}
+	cols, rows := pixels.exactSpans()
+	if len(cols)*len(rows) > maxExactSwatchCells || !regular(cols) || !regular(rows) {
+		// This is not a lossless image of equal-sized blocks.
+		cols, rows = pixels.noisySpans()
+	}
+	rv := &Palette{}
+	for _, row := range rows {
+		for _, col := range cols {
+			if c, ok := pixels.average(col.inset(), row.inset()); ok {
+				rv.Colors = append(rv.Colors, c)
+			}
+		}
+	}
+	if len(rv.Colors) == 0 {
+		return nil, fmt.Errorf("no color blocks found in swatch image")
+	}
+	return rv, nil
+}
+
+// span is a half-open range of pixel positions along one axis.
+type span struct {
+	start, end int
+}
+
+// inset returns the span with its outer pixels removed, since they are likely
+// to be blurred by JPEG compression. Spans too small to spare them are
+// returned unchanged.
+func (s span) inset() span {
+	margin := (s.end - s.start) / 6
+	if margin < 1 && s.end-s.start >= 5 {
+		margin = 1
+	}
+	return span{start: s.start + margin, end: s.end - margin}
+}
+
+// regular reports whether all of the spans have the same length.
+func regular(spans []span) bool {
+	for _, s := range spans {
+		if s.end-s.start != spans[0].end-spans[0].start {
+			return false
+		}
+	}
+	return true
+}
+
+// swatchGrid holds the pixels of an image as non-premultiplied 8-bit colors.
+type swatchGrid struct {
+	width, height int
+	pix           []color.NRGBA
+}
+
+// swatchPixels converts the image to a swatchGrid.
+func swatchPixels(img image.Image) *swatchGrid {
+	bounds := img.Bounds()
+	rv := &swatchGrid{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		pix:    make([]color.NRGBA, 0, bounds.Dx()*bounds.Dy()),
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rv.pix = append(rv.pix, color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA))
+		}
+	}
+	return rv
+}
+
+// at returns the pixel at (x, y), or at (y, x) if transpose is true.
+func (g *swatchGrid) at(x, y int, transpose bool) color.NRGBA {
+	if transpose {
+		x, y = y, x
+	}
+	return g.pix[y*g.width+x]
+}
+
+// size returns the length of the given axis, and of the other axis.
+func (g *swatchGrid) size(transpose bool) (int, int) {
+	if transpose {
+		return g.height, g.width
+	}
+	return g.width, g.height
+}
+
+// channelDiff returns the largest difference between any channel of the two
+// colors.
+func channelDiff(a, b color.NRGBA) int {
+	rv := 0
+	for _, d := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+		if d < 0 {
+			d = -d
+		}
+		if d > rv {
+			rv = d
+		}
+	}
+	return rv
+}
+
+// boundaries returns, for each position along the axis, the number of lines
+// across the axis in which the pixel at that position differs by more than the
+// given tolerance from the pixel gap positions before it.
+func (g *swatchGrid) boundaries(transpose bool, tolerance, gap int) []int {
+	length, across := g.size(transpose)
+	rv := make([]int, length)
+	for i := 1; i < length; i++ {
+		prev := i - gap
+		if prev < 0 {
+			prev = 0
+		}
+		for j := 0; j < across; j++ {
+			if channelDiff(g.at(i, j, transpose), g.at(prev, j, transpose)) > tolerance {
+				rv[i]++
+			}
+		}
+	}
+	return rv
+}
+
+// exactSpans divides the image into cells at every position where any pixel
+// differs from its neighbor.
+func (g *swatchGrid) exactSpans() ([]span, []span) {
+	split := func(transpose bool) []span {
+		var rv []span
+		start := 0
+		for i, count := range g.boundaries(transpose, 0, 1) {
+			if count > 0 {
+				rv = append(rv, span{start: start, end: i})
+				start = i
+			}
+		}
+		length, _ := g.size(transpose)
+		return append(rv, span{start: start, end: length})
+	}
+	return split(false), split(true)
+}
+
+// noisySpans divides the image into cells at positions where most lines across
+// the axis change by more than swatchTolerance. Edges in lossy images are
+// blurred over several pixels, so pixels are compared with those a few
+// positions before them, and each run of boundary positions produces a single
+// cut at its estimated center. Any remaining spans much narrower than the rest
+// are discarded as noise.
+func (g *swatchGrid) noisySpans() ([]span, []span) {
+	split := func(transpose bool) []span {
+		length, across := g.size(transpose)
+		var spans []span
+		start, runStart := 0, -1
+		counts := g.boundaries(transpose, swatchTolerance, swatchEdgeWidth)
+		for i := 0; i <= length; i++ {
+			if i < length && counts[i]*2 >= across {
+				if runStart < 0 {
+					runStart = i
+				}
+				continue
+			}
+			if runStart >= 0 {
+				// The run ends at i-1 and is offset by the comparison
+				// gap.
+				cut := (runStart+i-1)/2 - (swatchEdgeWidth-1)/2
+				if cut > start {
+					spans = append(spans, span{start: start, end: cut})
+					start = cut
+				}
+				runStart = -1
+			}
+		}
+		spans = append(spans, span{start: start, end: length})
+
+		lengths := make([]int, 0, len(spans))
+		for _, s := range spans {
+			lengths = append(lengths, s.end-s.start)
+		}
+		sort.Ints(lengths)
+		median := lengths[len(lengths)/2]
+		rv := make([]span, 0, len(spans))
+		for _, s := range spans {
+			if (s.end-s.start)*3 >= median {
+				rv = append(rv, s)
+			}
+		}
+		return rv
+	}
+	return split(false), split(true)
+}
+
+// average returns the mean color of the given cell, and false if the cell is
+// mostly transparent.
+func (g *swatchGrid) average(col, row span) (color.Color, bool) {
+	var r, gr, b, a, n float64
+	for y := row.start; y < row.end; y++ {
+		for x := col.start; x < col.end; x++ {
+			c := g.at(x, y, false)
+			r += float64(c.R)
+			gr += float64(c.G)
+			b += float64(c.B)
+			a += float64(c.A)
+			n++
+		}
+	}
+	if n == 0 || a/n < 128 {
+		return nil, false
+	}
+	round := func(v float64) uint8 {
+		return uint8(math.Round(v / n))
+	}
+	return nrgba(round(r), round(gr), round(b), round(a)), true
+}
+
+// ReadImage decodes an image in any format registered with the image package
+// and extracts its palette using ReadSwatchImage.
+func ReadImage(r io.Reader) (*Palette, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return ReadSwatchImage(img)
+}
+
+// swatchPaletted returns the image created by SwatchImage as an
+// image.Paletted with the palette's colors in order. It panics if the palette
+// has more than 256 colors.
+func swatchPaletted(p color.Palette) *image.Paletted {
+	rv := image.NewPaletted(image.Rect(0, 0, SwatchBlockSize, SwatchBlockSize*len(p)), append(color.Palette{}, p...))
+	for idx := range p {
+		for y := idx * SwatchBlockSize; y < (idx+1)*SwatchBlockSize; y++ {
+			for x := 0; x < SwatchBlockSize; x++ {
+				rv.SetColorIndex(x, y, uint8(idx))
+			}
+		}
+	}
+	return rv
+}
+
+// WritePNG writes the palette as a swatch image in PNG format. Palettes of up
+// to 256 colors are written as indexed images, which hold the colors exactly.
+func WritePNG(w io.Writer, p *Palette) error {
+	if len(p.Colors) > 256 {
+		return png.Encode(w, SwatchImage(p.Colors))
+	}
+	return png.Encode(w, swatchPaletted(p.Colors))
+}
+
+// WriteJPEG writes the palette as a swatch image in JPEG format.
+func WriteJPEG(w io.Writer, p *Palette) error {
+	return jpeg.Encode(w, SwatchImage(p.Colors), &jpeg.Options{Quality: 100})
+}
+
+// WriteGIF writes the palette as a swatch image in GIF format. GIF images may
+// hold at most 256 colors.
+func WriteGIF(w io.Writer, p *Palette) error {
+	if len(p.Colors) > 256 {
+		return fmt.Errorf("GIF images may hold at most 256 colors, found %d", len(p.Colors))
+	}
+	return gif.Encode(w, swatchPaletted(p.Colors), nil)
+}
@@ -0,0 +1,137 @@
+package paletteio
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// swatchColors returns n random, distinct, opaque colors.
+func swatchColors(n int) color.Palette {
+	r := rand.New(rand.NewSource(0))
+	rv := color.Palette{}
+	for len(rv) < n {
+		c := color.RGBA{R: uint8(r.Intn(256)), G: uint8(r.Intn(256)), B: uint8(r.Intn(256)), A: 255}
+		if len(rv) > 0 && channelDiff(color.NRGBA(c), color.NRGBA(rv[len(rv)-1].(color.RGBA))) < 64 {
+			// Neighboring blocks must be distinguishable through JPEG
+			// noise.
+			continue
+		}
+		rv = append(rv, c)
+	}
+	return rv
+}
+
+// gridImage draws the colors as a grid of blocks with the given number of
+// columns, leaving any remaining cells transparent.
+func gridImage(p color.Palette, columns, blockSize int) *image.NRGBA {
+	rows := (len(p) + columns - 1) / columns
+	img := image.NewNRGBA(image.Rect(0, 0, columns*blockSize, rows*blockSize))
+	for idx, c := range p {
+		x0, y0 := (idx%columns)*blockSize, (idx/columns)*blockSize
+		for y := y0; y < y0+blockSize; y++ {
+			for x := x0; x < x0+blockSize; x++ {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+// roundTrip encodes and decodes the image using the given encoder.
+func roundTrip(t *testing.T, img image.Image, encode func(*bytes.Buffer, image.Image) error) image.Image {
+	var buf bytes.Buffer
+	require.NoError(t, encode(&buf, img))
+	rv, _, err := image.Decode(&buf)
+	require.NoError(t, err)
+	return rv
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error {
+	return png.Encode(buf, img)
+}
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error {
+	return jpeg.Encode(buf, img, nil)
+}
+
+// requireColorsWithin asserts that each color matches the expected color to
+// within the given tolerance per channel.
+func requireColorsWithin(t *testing.T, expect, actual color.Palette, tolerance int) {
+	require.Len(t, actual, len(expect))
+	for idx := range expect {
+		e := color.NRGBAModel.Convert(expect[idx]).(color.NRGBA)
+		a := color.NRGBAModel.Convert(actual[idx]).(color.NRGBA)
+		require.LessOrEqual(t, channelDiff(e, a), tolerance, "color %d: expected %+v but got %+v", idx, e, a)
+	}
+}
+
+func TestReadSwatchImageExact(t *testing.T) {
+	colors := swatchColors(10)
+	for name, img := range map[string]image.Image{
+		"strip":           SwatchImage(colors),
+		"horizontal":      gridImage(colors, len(colors), 7),
+		"grid":            gridImage(colors, 4, 10),
+		"one pixel":       gridImage(colors, len(colors), 1),
+		"one pixel grid":  gridImage(colors, 3, 1),
+		"two pixel grid":  gridImage(colors, 3, 2),
+		"png round trip":  roundTrip(t, gridImage(colors, 5, 16), encodePNG),
+		"unequal columns": gridImage(colors, 2, 3),
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := ReadSwatchImage(img)
+			require.NoError(t, err)
+			requireColorsWithin(t, colors, p.Colors, 0)
+		})
+	}
+}
+
+func TestReadSwatchImageJPEG(t *testing.T) {
+	colors := swatchColors(12)
+	for name, img := range map[string]image.Image{
+		"strip": SwatchImage(colors),
+		"grid":  gridImage(colors, 4, 24),
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := ReadSwatchImage(roundTrip(t, img, encodeJPEG))
+			require.NoError(t, err)
+			requireColorsWithin(t, colors, p.Colors, 12)
+		})
+	}
+}
+
+func TestReadSwatchImageTranslucent(t *testing.T) {
+	colors := color.Palette{color.NRGBA{R: 255, A: 200}, color.RGBA{G: 255, A: 255}}
+	p, err := ReadSwatchImage(gridImage(colors, 2, 4))
+	require.NoError(t, err)
+	require.Equal(t, colors, p.Colors)
+}
+
+func TestReadSwatchImageErrors(t *testing.T) {
+	_, err := ReadSwatchImage(image.NewNRGBA(image.Rect(0, 0, 0, 0)))
+	require.Error(t, err)
+	_, err = ReadSwatchImage(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	require.Error(t, err)
+	_, err = ReadImage(bytes.NewReader([]byte("not an image")))
+	require.Error(t, err)
+}
+
+func TestWritePNGIndexed(t *testing.T) {
+	p := &Palette{Colors: color.Palette{color.RGBA{R: 1, G: 2, B: 3, A: 255}, color.NRGBA{R: 200, A: 100}, color.White}}
+	var buf bytes.Buffer
+	require.NoError(t, WritePNG(&buf, p))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	paletted, ok := img.(*image.Paletted)
+	require.True(t, ok)
+	require.Len(t, paletted.Palette, len(p.Colors))
+	for idx, c := range p.Colors {
+		require.Equal(t, color.NRGBAModel.Convert(c), color.NRGBAModel.Convert(paletted.Palette[idx]))
+	}
+}